@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/ianbrown78/gcp-nuke/config"
+	"github.com/ianbrown78/gcp-nuke/helpers"
 	"github.com/ianbrown78/gcp-nuke/resources"
 	"github.com/urfave/cli/v2"
 )
@@ -15,12 +19,38 @@ func Command() {
 	app := &cli.App{
 		Usage:     "The GCP project cleanup tool with added radiation",
 		Version:   "v0.1.0",
-		UsageText: "e.g. resources-nuke --project resources-nuke-test --dryrun",
+		UsageText: "e.g. resources-nuke --project resources-nuke-test --config nuke-config.yaml",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
-				Name:     "project, p",
-				Usage:    "GCP project id to nuke (required)",
-				Required: true,
+				Name:     "config, c",
+				Usage:    "Path to the nuke config file, required to nuke",
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "project",
+				Usage:    "GCP project id to nuke. Can be repeated, every project listed in the config file is nuked if not given",
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "parent",
+				Usage:    "Also nuke the projects below this folder or organization and its nested folders, eg. folders/1234. Can be repeated. Projects still have to be allowed by the config file",
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "label",
+				Usage:    "Only discover projects with this label, as key=value or key. Can be repeated, every label has to match",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "discover-only",
+				Usage:    "Only print the projects which would be nuked, without listing their resources",
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "max-parallel-projects",
+				Value:    1,
+				Usage:    "Maximum number of projects nuked at the same time",
+				Required: false,
 			},
 			&cli.BoolFlag{
 				Name:     "no-dryrun, d",
@@ -36,32 +66,226 @@ func Command() {
 			&cli.IntFlag{
 				Name:     "polltime, pt",
 				Value:    10,
-				Usage:    "Time for polling resource deletion status in seconds",
+				Usage:    "Initial interval for polling operation status in seconds, doubled after every poll up to 30 seconds",
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "concurrency",
+				Value:    8,
+				Usage:    "Maximum number of resource types deleted at the same time",
 				Required: false,
 			},
 			&cli.BoolFlag{
 				Name:     "no-keep-project, k",
-				Usage:    "Do not keep the project. Delete it with its resources.",
+				Usage:    "Do not keep the project. Delete it after its resources, only with --no-dryrun and once every resource type is done",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "remove-liens",
+				Usage:    "Remove the liens on the project before deleting it with --no-keep-project. Liens keep the project otherwise",
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "project-timeout",
+				Value:    600,
+				Usage:    "Timeout for the deletion of the project itself with --no-keep-project in seconds",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "force",
+				Usage:    "Do not ask for confirmation, count down instead. Required when stdin is not a terminal.",
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "force-sleep",
+				Value:    15,
+				Usage:    "Seconds to count down before deleting when running with --force (minimum 3)",
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "include-types",
+				Usage:    "Only nuke these resource types, comma separated. Overrides resource-types.includes in the config file",
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "exclude-types",
+				Usage:    "Never nuke these resource types, comma separated. Added to resource-types.excludes in the config file",
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "regions",
+				Usage:    "Only nuke regional resources in these regions, comma separated, * matches any characters, eg. europe-*. Overrides regions in the config file",
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "zones",
+				Usage:    "Only nuke zonal resources in these zones, comma separated, * matches any characters. Overrides zones in the config file",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "include-global",
+				Usage:    "Also nuke global resources such as networks, firewalls and secrets when restricted with --regions or --zones. They are kept otherwise, as other regions may use them",
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "older-than",
+				Usage:    "Only nuke resources created longer ago than this, eg. 24h",
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "newer-than",
+				Usage:    "Only nuke resources created more recently than this, eg. 2h",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "credentials-file",
+				Usage:    "Service account key file to use instead of GOOGLE_APPLICATION_CREDENTIALS / Application Default Credentials",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "user-agent",
+				Value:    "gcp-nuke",
+				Usage:    "User agent sent with every API request",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "quota-project",
+				Usage:    "Project billed for API quota, if it should not be the project of the credentials",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "output",
+				Value:    config.OutputText,
+				Usage:    "Report the outcome of every item as json, ndjson or text. json and ndjson are written to stdout, logs to stderr",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "checkpoint",
+				Usage:    "Write the state of the run to this JSON file after every change, so it can be continued with --resume",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "resume",
+				Usage:    "Continue the run recorded in this checkpoint file, waiting for its pending operations first. The file keeps being updated",
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "endpoint",
+				Usage:    "Override the endpoint of an API service as service=url, eg. compute=http://localhost:8080/compute/v1/. Can be repeated",
 				Required: false,
 			},
 		},
 		Action: func(c *cli.Context) error {
-			// Behaviour to delete all resource in parallel in one project at a time - will be made into loop / concurrenct project nuke if required
-			config := config.Config{
-				Project:       c.String("project"),
-				NoDryRun:      c.Bool("no-dryrun"),
-				Timeout:       c.Int("timeout"),
-				PollTime:      c.Int("polltime"),
-				NoKeepProject: c.Bool("no-keep-project"),
-				Context:       resources.Ctx,
-				Zones:         resources.GetZones(resources.Ctx, c.String("project")),
-				Regions:       resources.GetRegions(resources.Ctx, c.String("project")),
+			configs, err := runConfigs(c)
+			if err != nil {
+				return err
 			}
-
-			log.Printf("[Info] Timeout %v seconds. Polltime %v seconds. Dry run: %v", config.Timeout, config.PollTime, config.NoDryRun)
-			resources.RemoveProjectResources(config)
-
-			return nil
+			if c.Bool("discover-only") {
+				if len(configs) == 0 {
+					log.Printf("[Info] No project matched, nothing would be nuked")
+				}
+				for _, projectConfig := range configs {
+					log.Printf("[Info] Project %v would be nuked", projectConfig.Project)
+				}
+				return nil
+			}
+			log.Printf("[Info] Timeout %v seconds. Polltime %v seconds. Dry run: %v", configs[0].Timeout, configs[0].PollTime, configs[0].NoDryRun)
+			return resources.RemoveProjects(configs, c.Int("max-parallel-projects"))
+		},
+		Commands: []*cli.Command{
+			{
+				Name:      "plan",
+				Usage:     "List the resources which would be nuked and write them to a plan file, to be deleted with apply",
+				UsageText: "e.g. gcp-nuke --project test-nuke-123456 --config nuke-config.yaml plan --out nuke.plan",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "out",
+						Usage:    "Path of the plan file to write (required)",
+						Required: true,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					config, err := singleProjectConfig(c)
+					if err != nil {
+						return err
+					}
+					config.NoDryRun = false
+					return resources.WritePlan(config, c.String("out"))
+				},
+			},
+			{
+				Name:      "apply",
+				Usage:     "Delete exactly the resources of a plan file. Resources created since the plan was written are kept",
+				UsageText: "e.g. gcp-nuke --project test-nuke-123456 --config nuke-config.yaml apply nuke.plan",
+				ArgsUsage: "<planfile>",
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return fmt.Errorf("apply needs exactly one plan file")
+					}
+					config, err := singleProjectConfig(c)
+					if err != nil {
+						return err
+					}
+					if config.NoKeepProject {
+						return fmt.Errorf("apply only deletes the resources of the plan, it cannot be combined with --no-keep-project")
+					}
+					plan, err := resources.ReadPlan(c.Args().First(), config.Project)
+					if err != nil {
+						return err
+					}
+					if len(plan.ResourceTypes()) == 0 {
+						log.Printf("[Info] Plan for project %v has nothing to delete", config.Project)
+						return nil
+					}
+					config.Plan = plan.Items()
+					config.IncludeTypes = plan.ResourceTypes()
+					config.NoDryRun = true
+					log.Printf("[Info] Applying plan %v (hash: %v). Timeout %v seconds. Polltime %v seconds.", c.Args().First(), plan.Hash, config.Timeout, config.PollTime)
+					return resources.RemoveProjectResources(config)
+				},
+			},
+			{
+				Name:      "list",
+				Usage:     "Print every item of the selected resource types with its metadata, without deleting anything. Does not need a config file",
+				UsageText: "e.g. gcp-nuke --project test-nuke-123456 list --sort size --output csv",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "output",
+						Value:    resources.InventoryText,
+						Usage:    "Print the items as text, json or csv",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "sort",
+						Value:    resources.SortType,
+						Usage:    "Sort the items by type, name, location, created (oldest first) or size (largest first)",
+						Required: false,
+					},
+				},
+				Action: list,
+			},
+			{
+				Name:      "list-types",
+				Usage:     "Print every resource type with the API service it uses and the types deleted before it",
+				UsageText: "e.g. gcp-nuke list-types --output dot | dot -Tsvg > deletion-order.svg",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "output",
+						Value:    resources.TypesText,
+						Usage:    "Print the types as text, json or dot (Graphviz)",
+						Required: false,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return resources.WriteResourceTypes(os.Stdout, c.String("output"))
+				},
+			},
+			{
+				Name:      "restore",
+				Usage:     "Restore projects deleted with --no-keep-project less than 30 days ago, or list the projects pending deletion below --parent",
+				UsageText: "e.g. gcp-nuke --project test-nuke-123456 --config nuke-config.yaml restore",
+				Action:    restore,
+			},
 		},
 	}
 
@@ -70,3 +294,286 @@ func Command() {
 		log.Fatal(err)
 	}
 }
+
+// runConfigs - validates the global flags and the config file, and builds the config of every project of the run
+func runConfigs(c *cli.Context) ([]config.Config, error) {
+	if !c.IsSet("config") {
+		return nil, fmt.Errorf("--config is required, the config file decides which projects may be nuked")
+	}
+	nukeConfig, err := config.LoadNukeConfig(c.String("config"))
+	if err != nil {
+		return nil, err
+	}
+	if c.Int("max-parallel-projects") < 1 {
+		return nil, fmt.Errorf("--max-parallel-projects must be at least 1")
+	}
+	if c.Duration("older-than") < 0 || c.Duration("newer-than") < 0 {
+		return nil, fmt.Errorf("--older-than and --newer-than must not be negative")
+	}
+	if c.Int("force-sleep") < 3 {
+		return nil, fmt.Errorf("--force-sleep must be at least 3 seconds")
+	}
+	if c.Int("concurrency") < 1 {
+		return nil, fmt.Errorf("--concurrency must be at least 1")
+	}
+	if c.Bool("remove-liens") && !c.Bool("no-keep-project") {
+		return nil, fmt.Errorf("--remove-liens only works with --no-keep-project")
+	}
+	if c.Int("project-timeout") < 1 {
+		return nil, fmt.Errorf("--project-timeout must be at least 1 second")
+	}
+	switch c.String("output") {
+	case config.OutputText, config.OutputJSON, config.OutputNDJSON:
+	default:
+		return nil, fmt.Errorf("--output must be one of %v, %v or %v", config.OutputText, config.OutputJSON, config.OutputNDJSON)
+	}
+	checkpointFile := c.String("checkpoint")
+	if c.IsSet("resume") {
+		if c.IsSet("checkpoint") && checkpointFile != c.String("resume") {
+			return nil, fmt.Errorf("--checkpoint and --resume must be the same file")
+		}
+		checkpointFile = c.String("resume")
+	}
+	selector := resources.ProjectSelector{
+		Parents: c.StringSlice("parent"),
+		Labels:  c.StringSlice("label"),
+	}
+	if err := resources.CheckProjectSelector(selector); err != nil {
+		return nil, err
+	}
+	regions := nukeConfig.Regions
+	if c.IsSet("regions") {
+		regions = c.StringSlice("regions")
+	}
+	zones := nukeConfig.Zones
+	if c.IsSet("zones") {
+		zones = c.StringSlice("zones")
+	}
+	if err := config.CheckLocationPatterns("--regions", regions); err != nil {
+		return nil, err
+	}
+	if err := config.CheckLocationPatterns("--zones", zones); err != nil {
+		return nil, err
+	}
+	if c.Bool("include-global") && len(regions) == 0 && len(zones) == 0 {
+		return nil, fmt.Errorf("--include-global only works with --regions or --zones, global resources are nuked otherwise")
+	}
+
+	includeTypes := nukeConfig.ResourceTypes.Includes
+	if c.IsSet("include-types") {
+		includeTypes = c.StringSlice("include-types")
+	}
+	excludeTypes := append(nukeConfig.ResourceTypes.Excludes, c.StringSlice("exclude-types")...)
+	if err := resources.CheckDependencyGraph(); err != nil {
+		return nil, err
+	}
+	if err := resources.CheckResourceTypes(includeTypes, excludeTypes); err != nil {
+		return nil, err
+	}
+	for _, projectConfig := range nukeConfig.Projects {
+		if err := resources.CheckFilterTypes(projectConfig.Filters); err != nil {
+			return nil, err
+		}
+	}
+
+	base, err := clientConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	base.Regions = regions
+	base.Zones = zones
+	base.IncludeGlobal = c.Bool("include-global")
+	base.NoDryRun = c.Bool("no-dryrun")
+	base.Concurrency = c.Int("concurrency")
+	base.Resume = c.IsSet("resume")
+	base.Output = c.String("output")
+	base.NoKeepProject = c.Bool("no-keep-project")
+	base.ProjectTimeout = c.Int("project-timeout")
+	base.RemoveLiens = c.Bool("remove-liens")
+	base.Force = c.Bool("force")
+	base.ForceSleep = c.Int("force-sleep")
+	base.IncludeTypes = includeTypes
+	base.ExcludeTypes = excludeTypes
+	base.OlderThan = c.Duration("older-than")
+	base.NewerThan = c.Duration("newer-than")
+
+	projects, err := selectProjects(c.StringSlice("project"), nukeConfig, base, selector, c.Bool("discover-only"))
+	if err != nil {
+		return nil, err
+	}
+
+	configs := []config.Config{}
+	for _, project := range projects {
+		projectConfig := base
+		projectConfig.Project = project
+		projectConfig.CheckpointFile = checkpointFile
+		if checkpointFile != "" && len(projects) > 1 {
+			// One checkpoint per project, eg. run.json becomes run.my-project.json
+			extension := filepath.Ext(checkpointFile)
+			projectConfig.CheckpointFile = fmt.Sprintf("%v.%v%v", strings.TrimSuffix(checkpointFile, extension), project, extension)
+		}
+		settings, _ := nukeConfig.ProjectConfig(project)
+		projectConfig.Filters = settings.Filters
+		configs = append(configs, projectConfig)
+	}
+	return configs, nil
+}
+
+// clientConfig - config with the API clients and operation timings of the global flags, but no project
+func clientConfig(c *cli.Context) (config.Config, error) {
+	endpoints, err := resources.ParseEndpoints(c.StringSlice("endpoint"))
+	if err != nil {
+		return config.Config{}, err
+	}
+	clientOptions, err := resources.NewClientOptions(resources.Ctx, resources.ClientSettings{
+		CredentialsFile: c.String("credentials-file"),
+		UserAgent:       c.String("user-agent"),
+		QuotaProject:    c.String("quota-project"),
+	})
+	if err != nil {
+		return config.Config{}, err
+	}
+	return config.Config{
+		Timeout:       c.Int("timeout"),
+		PollTime:      c.Int("polltime"),
+		Context:       resources.Ctx,
+		ClientOptions: clientOptions,
+		Endpoints:     endpoints,
+	}, nil
+}
+
+// list - prints the inventory of every --project, selected by the type, location and age flags
+func list(c *cli.Context) error {
+	projects := c.StringSlice("project")
+	if len(projects) == 0 {
+		return fmt.Errorf("list needs at least one --project")
+	}
+	if err := resources.CheckInventoryOptions(c.String("output"), c.String("sort")); err != nil {
+		return err
+	}
+	if err := config.CheckLocationPatterns("--regions", c.StringSlice("regions")); err != nil {
+		return err
+	}
+	if err := config.CheckLocationPatterns("--zones", c.StringSlice("zones")); err != nil {
+		return err
+	}
+	if c.Duration("older-than") < 0 || c.Duration("newer-than") < 0 {
+		return fmt.Errorf("--older-than and --newer-than must not be negative")
+	}
+	base, err := clientConfig(c)
+	if err != nil {
+		return err
+	}
+
+	configs := []config.Config{}
+	for _, project := range projects {
+		projectConfig := base
+		projectConfig.Project = project
+		projectConfig.IncludeTypes = c.StringSlice("include-types")
+		projectConfig.ExcludeTypes = c.StringSlice("exclude-types")
+		projectConfig.Regions = c.StringSlice("regions")
+		projectConfig.Zones = c.StringSlice("zones")
+		projectConfig.IncludeGlobal = c.Bool("include-global")
+		projectConfig.OlderThan = c.Duration("older-than")
+		projectConfig.NewerThan = c.Duration("newer-than")
+		configs = append(configs, projectConfig)
+	}
+	items, listErr := resources.ListInventory(configs)
+	if items == nil {
+		return listErr
+	}
+	if err := resources.WriteInventory(os.Stdout, items, c.String("output"), c.String("sort")); err != nil {
+		return err
+	}
+	return listErr
+}
+
+// restore - restores every --project, or lists the projects pending deletion below --parent
+func restore(c *cli.Context) error {
+	projects := c.StringSlice("project")
+	selector := resources.ProjectSelector{Parents: c.StringSlice("parent")}
+	if len(projects) == 0 && len(selector.Parents) == 0 {
+		return fmt.Errorf("restore needs --project to restore, or --parent to list the projects pending deletion")
+	}
+	if err := resources.CheckProjectSelector(selector); err != nil {
+		return err
+	}
+	base, err := clientConfig(c)
+	if err != nil {
+		return err
+	}
+	if len(projects) == 0 {
+		deleted, err := resources.DeletedProjects(base, selector.Parents)
+		if err != nil {
+			return err
+		}
+		log.Printf("[Info] %v project(s) pending deletion below %v", len(deleted), strings.Join(selector.Parents, ", "))
+		for _, project := range deleted {
+			log.Printf("[Info] Project %v deleted at %v [parent: %v]", project.ProjectId, project.DeleteTime, project.Parent)
+		}
+		return nil
+	}
+
+	failed := []string{}
+	for _, project := range projects {
+		projectConfig := base
+		projectConfig.Project = project
+		if err := resources.RestoreProject(projectConfig); err != nil {
+			log.Printf("[Error] Unable to restore project %v: %v", project, err)
+			failed = append(failed, project)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("[Error] %v of %v projects could not be restored: %v", len(failed), len(projects), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// selectProjects - projects given with --project, or discovered below --parent, or else every project of the config
+// file. Given projects have to be allowed by the config file, discovered projects which are not are skipped. No
+// project is an error, unless the run only discovers them.
+func selectProjects(given []string, nukeConfig *config.NukeConfig, base config.Config, selector resources.ProjectSelector, discoverOnly bool) ([]string, error) {
+	projects := append([]string{}, given...)
+	for i, project := range projects {
+		if helpers.SliceContains(projects[:i], project) {
+			return nil, fmt.Errorf("project %v is given more than once", project)
+		}
+		if err := nukeConfig.CheckProject(project); err != nil {
+			return nil, err
+		}
+	}
+	if len(selector.Parents) > 0 {
+		discovered, err := resources.DiscoverProjects(base, selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, project := range discovered {
+			if err := nukeConfig.CheckProject(project); err != nil {
+				log.Printf("[Skipping] Project %v: %v", project, err)
+				continue
+			}
+			if !helpers.SliceContains(projects, project) {
+				projects = append(projects, project)
+			}
+		}
+	} else if len(projects) == 0 {
+		projects = nukeConfig.ProjectIDs()
+		log.Printf("[Info] No --project given, using every project of the config file: %v", strings.Join(projects, ", "))
+	}
+	if len(projects) == 0 && !discoverOnly {
+		return nil, fmt.Errorf("no project to nuke, give --project or --parent, or list projects in the config file")
+	}
+	return projects, nil
+}
+
+// singleProjectConfig - config of the run, for commands which work on exactly one project
+func singleProjectConfig(c *cli.Context) (config.Config, error) {
+	configs, err := runConfigs(c)
+	if err != nil {
+		return config.Config{}, err
+	}
+	if len(configs) != 1 {
+		return config.Config{}, fmt.Errorf("%v works on a single project, give exactly one --project", c.Command.Name)
+	}
+	return configs[0], nil
+}
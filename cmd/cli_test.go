@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/ianbrown78/gcp-nuke/config"
+	"github.com/ianbrown78/gcp-nuke/internal/fakegcp"
+	"github.com/ianbrown78/gcp-nuke/resources"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestSelectProjectsDiscoverOnly(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	server.Seed(fakegcp.CloudResourceManager+"/projects", "sandbox-a", map[string]interface{}{
+		"name": "projects/sandbox-a", "projectId": "sandbox-a", "parent": "folders/1", "state": "ACTIVE",
+		"labels": map[string]interface{}{"env": "sandbox"},
+	})
+	nukeConfig := &config.NukeConfig{
+		Blocklist: []string{"production"},
+		Projects:  map[string]config.ProjectConfig{"sandbox-*": {}},
+	}
+	base := config.Config{
+		Context:       context.Background(),
+		ClientOptions: server.ClientOptions(),
+		Endpoints:     server.Endpoints(),
+	}
+
+	matching := resources.ProjectSelector{Parents: []string{"folders/1"}, Labels: []string{"env=sandbox"}}
+	projects, err := selectProjects(nil, nukeConfig, base, matching, true)
+	if err != nil || !reflect.DeepEqual(projects, []string{"sandbox-a"}) {
+		t.Errorf("expected sandbox-a to be discovered, got %v, %v", projects, err)
+	}
+
+	// Nothing matching is only an error when the projects would be nuked
+	unmatched := resources.ProjectSelector{Parents: []string{"folders/1"}, Labels: []string{"env=prod"}}
+	projects, err = selectProjects(nil, nukeConfig, base, unmatched, true)
+	if err != nil || len(projects) != 0 {
+		t.Errorf("expected no project and no error when only discovering, got %v, %v", projects, err)
+	}
+	if _, err := selectProjects(nil, nukeConfig, base, unmatched, false); err == nil {
+		t.Errorf("expected an error when there is no project to nuke")
+	}
+}
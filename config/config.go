@@ -2,16 +2,57 @@ package config
 
 import (
 	"context"
+	"time"
+
+	"google.golang.org/api/option"
+)
+
+// Output formats of a run
+const (
+	OutputText   = "text"
+	OutputJSON   = "json"
+	OutputNDJSON = "ndjson"
 )
 
 // Config -
 type Config struct {
-	Project       string
-	Zones         []string
-	Regions       []string
+	Project string
+	// Zones - zonal resources outside of these zones are not nuked, * matches any characters. None selects every zone.
+	Zones []string
+	// Regions - regional resources outside of these regions are not nuked, * matches any characters. None selects
+	// every region.
+	Regions []string
+	// IncludeGlobal - also nuke global resources, eg. networks and firewalls, when restricted to zones or regions
+	IncludeGlobal bool
 	Timeout       int
 	PollTime      int
 	Context       context.Context
 	NoDryRun      bool
 	NoKeepProject bool
+	Force         bool
+	ForceSleep    int
+	IncludeTypes  []string
+	ExcludeTypes  []string
+	Filters       map[string][]Filter
+	OlderThan     time.Duration
+	NewerThan     time.Duration
+	// ProjectTimeout - seconds to wait for the deletion of the project itself with NoKeepProject
+	ProjectTimeout int
+	// RemoveLiens - remove the liens on the project before deleting it with NoKeepProject
+	RemoveLiens bool
+	// Concurrency - maximum number of resource types deleted at the same time, below 1 means no limit
+	Concurrency int
+	// CheckpointFile - JSON file the state of the run is written to, none if empty
+	CheckpointFile string
+	// Resume - continue the run recorded in CheckpointFile
+	Resume bool
+	// Plan - items to delete by resource type and name, with their RFC 3339 creation time when planned (empty if
+	// unknown). Every other item is kept, as are items whose creation time changed. Nil deletes every listed item.
+	Plan map[string]map[string]string
+	// Output - format of the report of every item, text only logs
+	Output string
+	// ClientOptions - used to create every API client, eg. a shared authenticated HTTP client
+	ClientOptions []option.ClientOption
+	// Endpoints - API endpoint overrides by service name
+	Endpoints map[string]string
 }
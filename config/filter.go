@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Filter types
+const (
+	FilterExact = "exact"
+	FilterRegex = "regex"
+	FilterGlob  = "glob"
+	FilterLabel = "label"
+)
+
+// Filter - protects matching items of a resource type from deletion
+type Filter struct {
+	Type  string `yaml:"type"`
+	Value string `yaml:"value"`
+	// Key - label key, only used by label filters
+	Key   string `yaml:"key"`
+	regex *regexp.Regexp
+}
+
+// UnmarshalYAML - a plain string is shorthand for an exact name filter
+func (f *Filter) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		f.Type = FilterExact
+		return node.Decode(&f.Value)
+	}
+
+	// Alias avoids recursing into this method
+	type plainFilter Filter
+	plain := plainFilter{}
+	if err := node.Decode(&plain); err != nil {
+		return err
+	}
+	*f = Filter(plain)
+	if f.Type == "" {
+		f.Type = FilterExact
+	}
+	return f.compile()
+}
+
+// Validate - checks the type and value of a filter, eg. one built in code rather than read from the config file
+func (f Filter) Validate() error {
+	return f.compile()
+}
+
+func (f *Filter) compile() error {
+	switch f.Type {
+	case FilterExact, "":
+	case FilterRegex:
+		regex, err := regexp.Compile(f.Value)
+		if err != nil {
+			return fmt.Errorf("invalid regex filter %q: %v", f.Value, err)
+		}
+		f.regex = regex
+	case FilterGlob:
+		if _, err := path.Match(f.Value, ""); err != nil {
+			return fmt.Errorf("invalid glob filter %q: %v", f.Value, err)
+		}
+	case FilterLabel:
+		if f.Key == "" {
+			return fmt.Errorf("label filter requires a key")
+		}
+	default:
+		return fmt.Errorf("unknown filter type %q, valid types are: %v, %v, %v, %v", f.Type, FilterExact, FilterRegex, FilterGlob, FilterLabel)
+	}
+	return nil
+}
+
+// Matches - check if the item with the given name and labels matches the filter. An empty type is an exact match.
+// Regex filters are not anchored, they match any part of the name.
+func (f Filter) Matches(name string, labels map[string]string) bool {
+	switch f.Type {
+	case FilterExact, "":
+		return name == f.Value
+	case FilterRegex:
+		regex := f.regex
+		if regex == nil {
+			// Filters built in code are compiled on use. An invalid regex keeps every item rather than none.
+			compiled, err := regexp.Compile(f.Value)
+			if err != nil {
+				return true
+			}
+			regex = compiled
+		}
+		return regex.MatchString(name)
+	case FilterGlob:
+		matched, _ := path.Match(f.Value, name)
+		return matched
+	case FilterLabel:
+		value, exists := labels[f.Key]
+		// Without a value any item carrying the label key matches
+		return exists && (f.Value == "" || value == f.Value)
+	}
+	return false
+}
+
+// String - human readable description of the filter
+func (f Filter) String() string {
+	if f.Type == FilterLabel {
+		if f.Value == "" {
+			return fmt.Sprintf("label %v", f.Key)
+		}
+		return fmt.Sprintf("label %v=%v", f.Key, f.Value)
+	}
+	return fmt.Sprintf("%v %q", f.Type, f.Value)
+}
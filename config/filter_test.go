@@ -0,0 +1,78 @@
+package config
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestFilterMatches(t *testing.T) {
+	labels := map[string]string{"env": "persistent", "team": "data"}
+	tests := []struct {
+		filter   Filter
+		name     string
+		expected bool
+	}{
+		{Filter{Type: FilterExact, Value: "default"}, "default", true},
+		{Filter{Type: FilterExact, Value: "default"}, "default-2", false},
+		{Filter{Value: "default"}, "default", true},
+		// Regex filters are not anchored
+		{Filter{Type: FilterRegex, Value: "bastion-[0-9]+"}, "old-bastion-2", true},
+		{Filter{Type: FilterRegex, Value: "^bastion-[0-9]+$"}, "old-bastion-2", false},
+		{Filter{Type: FilterRegex, Value: "^bastion-[0-9]+$"}, "bastion-12", true},
+		{Filter{Type: FilterRegex, Value: "bastion-("}, "web-1", true},
+		{Filter{Type: FilterGlob, Value: "keep-*"}, "keep-logs", true},
+		{Filter{Type: FilterGlob, Value: "keep-*"}, "logs-keep", false},
+		{Filter{Type: FilterGlob, Value: "projects/*"}, "projects/p/secrets/s", false},
+		{Filter{Type: FilterLabel, Key: "env", Value: "persistent"}, "any", true},
+		{Filter{Type: FilterLabel, Key: "env", Value: "dev"}, "any", false},
+		{Filter{Type: FilterLabel, Key: "team"}, "any", true},
+		{Filter{Type: FilterLabel, Key: "owner"}, "any", false},
+	}
+	for _, test := range tests {
+		if matched := test.filter.Matches(test.name, labels); matched != test.expected {
+			t.Errorf("filter %v on %q: got %v, expected %v", test.filter, test.name, matched, test.expected)
+		}
+	}
+}
+
+func TestFilterUnmarshal(t *testing.T) {
+	filters := []Filter{}
+	err := yaml.Unmarshal([]byte("- default\n- type: regex\n  value: ^web-\n- type: label\n  key: env\n"), &filters)
+	if err != nil {
+		t.Fatalf("unable to parse filters: %v", err)
+	}
+	if len(filters) != 3 || filters[0].Type != FilterExact || filters[1].regex == nil || filters[2].Key != "env" {
+		t.Fatalf("unexpected filters: %+v", filters)
+	}
+	if !filters[1].Matches("web-1", nil) || filters[1].Matches("api-web-1", nil) {
+		t.Errorf("unexpected matches of %v", filters[1])
+	}
+
+	invalid := []string{
+		"- type: regex\n  value: \"web-(\"\n",
+		"- type: glob\n  value: \"web-[\"\n",
+		"- type: label\n  value: persistent\n",
+		"- type: prefix\n  value: web-\n",
+	}
+	for _, contents := range invalid {
+		if err := yaml.Unmarshal([]byte(contents), &filters); err == nil {
+			t.Errorf("expected an error for %q", contents)
+		}
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	valid := []Filter{{Value: "default"}, {Type: FilterRegex, Value: "^web-"}, {Type: FilterLabel, Key: "env"}}
+	for _, filter := range valid {
+		if err := filter.Validate(); err != nil {
+			t.Errorf("expected %v to be valid: %v", filter, err)
+		}
+	}
+	invalid := []Filter{{Type: FilterRegex, Value: "web-("}, {Type: FilterGlob, Value: "web-["}, {Type: FilterLabel}, {Type: "prefix"}}
+	for _, filter := range invalid {
+		if filter.Validate() == nil {
+			t.Errorf("expected %v to be invalid", filter)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// NukeConfig - contents of the mandatory config file
+type NukeConfig struct {
+	// Blocklist - project ids which are never nuked, * matches any characters
+	Blocklist []string `yaml:"blocklist"`
+	// Projects - project ids which may be nuked, * matches any characters, eg. for discovered sandbox-* projects
+	Projects      map[string]ProjectConfig `yaml:"projects"`
+	ResourceTypes ResourceTypes            `yaml:"resource-types"`
+	// Regions - only regional resources in these regions are nuked, * matches any characters, eg. europe-*
+	Regions []string `yaml:"regions"`
+	// Zones - only zonal resources in these zones are nuked, * matches any characters, eg. europe-west2-*
+	Zones []string `yaml:"zones"`
+}
+
+// ResourceTypes - restricts the run to a subset of the registered resource types
+type ResourceTypes struct {
+	Includes []string `yaml:"includes"`
+	Excludes []string `yaml:"excludes"`
+}
+
+// ProjectConfig - project specific settings
+type ProjectConfig struct {
+	// Filters - per resource type, items matching any of the filters are never deleted
+	Filters map[string][]Filter `yaml:"filters"`
+}
+
+// LoadNukeConfig - reads and validates the config file at path
+func LoadNukeConfig(path string) (*NukeConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file %v: %v", path, err)
+	}
+
+	nukeConfig := NukeConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+	// Unknown keys are most likely typos, which is not something to be lenient about in a safety config
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&nukeConfig); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %v: %v", path, err)
+	}
+
+	if err := nukeConfig.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %v: %v", path, err)
+	}
+	return &nukeConfig, nil
+}
+
+func (n *NukeConfig) validate() error {
+	if len(n.Blocklist) == 0 {
+		return fmt.Errorf("the blocklist must contain at least one project id")
+	}
+	for _, blocked := range n.Blocklist {
+		if _, err := path.Match(blocked, ""); err != nil {
+			return fmt.Errorf("invalid blocklist pattern %v", blocked)
+		}
+		if _, listed := n.Projects[blocked]; listed {
+			return fmt.Errorf("project %v is both blocklisted and listed under projects", blocked)
+		}
+	}
+	for project := range n.Projects {
+		if _, err := path.Match(project, ""); err != nil {
+			return fmt.Errorf("invalid project pattern %v", project)
+		}
+	}
+	if err := CheckLocationPatterns("regions", n.Regions); err != nil {
+		return err
+	}
+	return CheckLocationPatterns("zones", n.Zones)
+}
+
+// CheckLocationPatterns - validates the syntax of zone or region patterns, whether they match a location of the
+// project is only known once the locations are listed
+func CheckLocationPatterns(kind string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("invalid %v pattern %q", kind, pattern)
+		}
+	}
+	return nil
+}
+
+// CheckProject - returns an error unless the project may be nuked according to the config
+func (n *NukeConfig) CheckProject(project string) error {
+	for _, blocked := range n.Blocklist {
+		if matched, _ := path.Match(blocked, project); matched {
+			return fmt.Errorf("project %v is blocklisted in the config file, refusing to continue", project)
+		}
+	}
+	if _, listed := n.ProjectConfig(project); !listed {
+		return fmt.Errorf("project %v is not listed under projects in the config file, refusing to continue", project)
+	}
+	return nil
+}
+
+// ProjectConfig - settings of the project, from its own entry or else from the first matching pattern in sorted order
+func (n *NukeConfig) ProjectConfig(project string) (ProjectConfig, bool) {
+	if projectConfig, listed := n.Projects[project]; listed {
+		return projectConfig, true
+	}
+	patterns := []string{}
+	for pattern := range n.Projects {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, project); matched {
+			return n.Projects[pattern], true
+		}
+	}
+	return ProjectConfig{}, false
+}
+
+// ProjectIDs - sorted ids of the projects listed in the config, patterns are left out
+func (n *NukeConfig) ProjectIDs() []string {
+	projects := []string{}
+	for project := range n.Projects {
+		if strings.ContainsAny(project, "*?[") {
+			continue
+		}
+		projects = append(projects, project)
+	}
+	sort.Strings(projects)
+	return projects
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "nuke-config.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("unable to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadNukeConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		// expected - part of the error, empty if the config is valid
+		expected string
+	}{
+		{
+			name:     "valid",
+			contents: "blocklist: [production]\nprojects:\n  sandbox: {}\n",
+		},
+		{
+			name:     "empty blocklist",
+			contents: "blocklist: []\nprojects:\n  sandbox: {}\n",
+			expected: "blocklist must contain at least one project id",
+		},
+		{
+			name:     "missing blocklist",
+			contents: "projects:\n  sandbox: {}\n",
+			expected: "blocklist must contain at least one project id",
+		},
+		{
+			name:     "blocklisted and listed",
+			contents: "blocklist: [sandbox]\nprojects:\n  sandbox: {}\n",
+			expected: "both blocklisted and listed",
+		},
+		{
+			name:     "unknown key",
+			contents: "blocklist: [production]\nblacklist: [sandbox]\nprojects:\n  sandbox: {}\n",
+			expected: "field blacklist not found",
+		},
+		{
+			name:     "unknown project key",
+			contents: "blocklist: [production]\nprojects:\n  sandbox:\n    filter: {}\n",
+			expected: "field filter not found",
+		},
+		{
+			name:     "invalid blocklist pattern",
+			contents: "blocklist: [\"prod-[\"]\nprojects:\n  sandbox: {}\n",
+			expected: "invalid blocklist pattern",
+		},
+	}
+	for _, test := range tests {
+		_, err := LoadNukeConfig(writeConfig(t, test.contents))
+		switch {
+		case test.expected == "" && err != nil:
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+		case test.expected != "" && err == nil:
+			t.Errorf("%v: expected an error containing %q", test.name, test.expected)
+		case test.expected != "" && !strings.Contains(err.Error(), test.expected):
+			t.Errorf("%v: got %v, expected an error containing %q", test.name, err, test.expected)
+		}
+	}
+}
+
+func TestCheckProject(t *testing.T) {
+	nukeConfig := &NukeConfig{
+		Blocklist: []string{"production", "prod-*"},
+		Projects: map[string]ProjectConfig{
+			"sandbox":   {},
+			"sandbox-*": {},
+			"prod-*-1":  {},
+		},
+	}
+	if err := nukeConfig.validate(); err != nil {
+		t.Fatalf("unexpected invalid config: %v", err)
+	}
+
+	tests := []struct {
+		project string
+		// expected - part of the error, empty if the project may be nuked
+		expected string
+	}{
+		{"sandbox", ""},
+		{"sandbox-a", ""},
+		{"production", "blocklisted"},
+		// Blocklist patterns win over matching project patterns
+		{"prod-eu-1", "blocklisted"},
+		{"staging", "not listed"},
+		{"", "not listed"},
+	}
+	for _, test := range tests {
+		err := nukeConfig.CheckProject(test.project)
+		switch {
+		case test.expected == "" && err != nil:
+			t.Errorf("project %q: unexpected error: %v", test.project, err)
+		case test.expected != "" && err == nil:
+			t.Errorf("project %q: expected an error containing %q", test.project, test.expected)
+		case test.expected != "" && !strings.Contains(err.Error(), test.expected):
+			t.Errorf("project %q: got %v, expected an error containing %q", test.project, err, test.expected)
+		}
+	}
+}
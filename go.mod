@@ -6,6 +6,7 @@ require (
 	github.com/urfave/cli/v2 v2.23.7
 	golang.org/x/sync v0.1.0
 	google.golang.org/api v0.110.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -42,13 +42,40 @@ func SortedSyncMapKeys(parMap *syncmap.Map) (output []string) {
 	return output
 }
 
-// SetupCloseHandler - allows manual termination
-func SetupCloseHandler() {
+// ClearSyncMap - deletes every key in place, so that concurrent readers never race with a replaced map
+func ClearSyncMap(parMap *syncmap.Map) {
+	parMap.Range(func(key, value interface{}) bool {
+		parMap.Delete(key)
+		return true
+	})
+}
+
+// SetupCloseHandler - allows manual termination. The first SIGINT / SIGTERM calls interrupt, which should stop
+// starting new work. The second calls terminate and exits. Messages go to stderr, like the logs. The returned function stops handling the signals.
+func SetupCloseHandler(interrupt, terminate func()) func() {
 	c := make(chan os.Signal, 2)
+	done := make(chan struct{})
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		<-c
-		fmt.Println("\r- Ctrl+C pressed in Terminal - premature termination")
+		select {
+		case <-c:
+		case <-done:
+			return
+		}
+		fmt.Fprintln(os.Stderr, "\r- Ctrl+C pressed in Terminal - waiting for in-flight deletions, press Ctrl+C again to exit immediately")
+		interrupt()
+
+		select {
+		case <-c:
+		case <-done:
+			return
+		}
+		fmt.Fprintln(os.Stderr, "\r- Ctrl+C pressed again - premature termination")
+		terminate()
 		os.Exit(1)
 	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
 }
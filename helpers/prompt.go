@@ -0,0 +1,42 @@
+package helpers
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// IsTerminal - check if stdin is attached to a terminal
+func IsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Prompt - ask the user to retype expected, returns an error on any other input. The question is written to stderr,
+// stdout only carries reports.
+func Prompt(question, expected string) error {
+	fmt.Fprintf(os.Stderr, "%v\nType '%v' to continue: ", question, expected)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("unable to read confirmation: %v", err)
+	}
+	if strings.TrimSpace(answer) != expected {
+		return fmt.Errorf("confirmation '%v' does not match '%v', aborting", strings.TrimSpace(answer), expected)
+	}
+	return nil
+}
+
+// Countdown - gives the user a chance to abort a non-interactive run with Ctrl+C
+func Countdown(reason string, seconds int) {
+	log.Printf("[Confirm] %v. Press Ctrl+C within %v seconds to abort.", reason, seconds)
+	for remaining := seconds; remaining > 0; remaining-- {
+		log.Printf("[Confirm] %v...", remaining)
+		time.Sleep(time.Second)
+	}
+}
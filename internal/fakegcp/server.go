@@ -0,0 +1,680 @@
+// Package fakegcp is an in-memory emulation of the subset of Google Cloud REST APIs used by gcp-nuke, for hermetic tests.
+//
+// Items are stored per collection path, eg. /compute/v1/projects/p/zones/z/instances, and are served as JSON
+// exactly as seeded. Deletes and updates return operations in the style of the API they belong to, which
+// complete after OperationPolls polls.
+package fakegcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/option"
+)
+
+// Path prefixes of the emulated APIs, matching the endpoints returned by Endpoints
+const (
+	BigQuery             = "/bigquery/v2"
+	CloudFunctions       = "/cloudfunctions/v2"
+	CloudResourceManager = "/cloudresourcemanager/v3"
+	Compute              = "/compute/v1"
+	Container            = "/container/v1"
+	SecretManager        = "/secretmanager/v1"
+	SQLAdmin             = "/sqladmin/sql/v1beta4"
+	Storage              = "/storage/v1"
+)
+
+// listSegments - last path segments which address a collection rather than an item
+var listSegments = map[string]bool{
+	"autoscalers":           true,
+	"b":                     true,
+	"clusters":              true,
+	"datasets":              true,
+	"disks":                 true,
+	"firewalls":             true,
+	"folders":               true,
+	"functions":             true,
+	"instanceGroupManagers": true,
+	"instanceTemplates":     true,
+	"instances":             true,
+	"liens":                 true,
+	"locations":             true,
+	"networks":              true,
+	"o":                     true,
+	"projects":              true,
+	"regions":               true,
+	"routers":               true,
+	"secrets":               true,
+	"subnetworks":           true,
+	"vpnGateways":           true,
+	"vpnTunnels":            true,
+	"zones":                 true,
+}
+
+// actionVerbs - custom methods, POSTed to an item path followed by the verb
+var actionVerbs = map[string]bool{
+	"setDiskAutoDelete": true,
+	"removePeering":     true,
+}
+
+// Server - fake Google Cloud API server
+type Server struct {
+	*httptest.Server
+	// OperationPolls - number of polls an operation reports as running before it is done
+	OperationPolls int
+	// PageSize - maximum number of items per list response, 0 serves every item on a single page
+	PageSize int
+	// OnRequest - called for every request before it is served, with the server locked
+	OnRequest func(method, requestPath string)
+
+	mutex       sync.Mutex
+	collections map[string]*collection
+	operations  map[string]*operation
+	errors      []*injectedError
+	blockers    map[string]string
+	failures    map[string]*failedOperation
+	requests    []string
+	opCounter   int
+}
+
+type collection struct {
+	names []string
+	items map[string]map[string]interface{}
+}
+
+type operation struct {
+	name      string
+	remaining int
+	// doneStyle - google.longrunning style operation with a done flag, instead of a status
+	doneStyle bool
+	// rpcErrors - the error is a google.rpc.Status, instead of a list of errors
+	rpcErrors bool
+	fields    map[string]interface{}
+	errorCode string
+}
+
+type failedOperation struct {
+	times int
+	code  string
+}
+
+// rpcCodes - google.rpc.Code values of the error codes operations can fail with
+var rpcCodes = map[string]int{
+	"NOT_FOUND":           5,
+	"PERMISSION_DENIED":   7,
+	"RESOURCE_EXHAUSTED":  8,
+	"FAILED_PRECONDITION": 9,
+	"ABORTED":             10,
+	"INTERNAL":            13,
+}
+
+type injectedError struct {
+	method string
+	path   string
+	times  int
+	code   int
+	reason string
+}
+
+// NewServer - starts a fake server, close it with Close
+func NewServer() *Server {
+	s := &Server{
+		collections: make(map[string]*collection),
+		operations:  make(map[string]*operation),
+		blockers:    make(map[string]string),
+		failures:    make(map[string]*failedOperation),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Endpoints - endpoint overrides pointing every service at the fake server
+func (s *Server) Endpoints() map[string]string {
+	return map[string]string{
+		"bigquery":             s.URL + BigQuery + "/",
+		"cloudfunctions":       s.URL + "/cloudfunctions/",
+		"cloudresourcemanager": s.URL + "/cloudresourcemanager/",
+		"compute":              s.URL + Compute + "/",
+		"container":            s.URL + "/container/",
+		"secretmanager":        s.URL + "/secretmanager/",
+		"sqladmin":             s.URL + "/sqladmin/",
+		"storage":              s.URL + Storage + "/",
+	}
+}
+
+// ClientOptions - options for unauthenticated clients talking to the fake server
+func (s *Server) ClientOptions() []option.ClientOption {
+	return []option.ClientOption{option.WithHTTPClient(s.Client())}
+}
+
+// Seed - adds an item to a collection, the object is served as is
+func (s *Server) Seed(collectionPath, name string, object map[string]interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.collection(collectionPath).put(name, object)
+}
+
+// Items - names of the items in a collection, in insertion order
+func (s *Server) Items(collectionPath string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if c, exists := s.collections[collectionPath]; exists {
+		return append([]string{}, c.names...)
+	}
+	return []string{}
+}
+
+// Exists - check if an item exists
+func (s *Server) Exists(collectionPath, name string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	c, exists := s.collections[collectionPath]
+	if !exists {
+		return false
+	}
+	_, exists = c.items[name]
+	return exists
+}
+
+// Field - value of a field of an item, nil if the item does not exist
+func (s *Server) Field(collectionPath, name, field string) interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	c, exists := s.collections[collectionPath]
+	if !exists || c.items[name] == nil {
+		return nil
+	}
+	return c.items[name][field]
+}
+
+// InjectError - the next times requests with method to the path fail with the given status code and reason
+func (s *Server) InjectError(method, requestPath string, times, code int, reason string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.errors = append(s.errors, &injectedError{method: method, path: requestPath, times: times, code: code, reason: reason})
+}
+
+// BlockDelete - deleting the item fails with resourceInUseByAnotherResource while any collection matching the
+// pattern (see path.Match) has items
+func (s *Server) BlockDelete(itemPath, collectionPattern string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.blockers[itemPath] = collectionPattern
+}
+
+// FailOperation - the next times operations started by a request on itemPath finish with the error code,
+// eg. RESOURCE_IN_USE_BY_ANOTHER_RESOURCE for Compute or FAILED_PRECONDITION for APIs using google.rpc codes.
+// The item is left unchanged.
+func (s *Server) FailOperation(itemPath string, times int, code string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures[itemPath] = &failedOperation{times: times, code: code}
+}
+
+// StartOperation - starts an operation in scope, eg. a zone path, as if the run which started it was interrupted.
+// Returns the operation name.
+func (s *Server) StartOperation(scope string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.newOperation(scope, "")["name"].(string)
+}
+
+// Requests - every request received so far, as "METHOD path"
+func (s *Server) Requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+func (s *Server) collection(collectionPath string) *collection {
+	c, exists := s.collections[collectionPath]
+	if !exists {
+		c = &collection{items: make(map[string]map[string]interface{})}
+		s.collections[collectionPath] = c
+	}
+	return c
+}
+
+func (c *collection) put(name string, object map[string]interface{}) {
+	if _, exists := c.items[name]; !exists {
+		c.names = append(c.names, name)
+	}
+	c.items[name] = object
+}
+
+func (c *collection) remove(name string) {
+	delete(c.items, name)
+	for i, existing := range c.names {
+		if existing == name {
+			c.names = append(c.names[:i], c.names[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	requestPath := strings.TrimSuffix(r.URL.Path, "/")
+	s.requests = append(s.requests, r.Method+" "+requestPath)
+	if s.OnRequest != nil {
+		s.OnRequest(r.Method, requestPath)
+	}
+
+	if err := s.popError(r.Method, requestPath); err != nil {
+		writeError(w, err.code, err.reason)
+		return
+	}
+
+	dir, base := path.Split(requestPath)
+	dir = strings.TrimSuffix(dir, "/")
+	switch {
+	case r.Method == http.MethodGet && path.Base(dir) == "operations":
+		s.getOperation(w, requestPath)
+	case r.Method == http.MethodGet && base == "projects:search":
+		s.search(w, r, dir+"/projects")
+	case r.Method == http.MethodGet && path.Base(dir) == "aggregated":
+		s.aggregatedList(w, r, path.Dir(dir), base)
+	case r.Method == http.MethodGet && listSegments[base]:
+		s.list(w, r, requestPath)
+	case r.Method == http.MethodGet:
+		s.get(w, dir, base)
+	case r.Method == http.MethodPost && strings.HasSuffix(base, ":undelete"):
+		s.undelete(w, dir, strings.TrimSuffix(base, ":undelete"))
+	case r.Method == http.MethodPost && actionVerbs[base]:
+		s.action(w, r, dir, base)
+	case r.Method == http.MethodDelete:
+		s.delete(w, requestPath, dir, base)
+	case r.Method == http.MethodPut || r.Method == http.MethodPatch:
+		s.update(w, r, dir, base)
+	default:
+		writeError(w, http.StatusNotImplemented, "notImplemented")
+	}
+}
+
+func (s *Server) popError(method, requestPath string) *injectedError {
+	for _, err := range s.errors {
+		if err.times > 0 && err.method == method && err.path == requestPath {
+			err.times--
+			return err
+		}
+	}
+	return nil
+}
+
+// list - serves a collection, a "-" segment matches any value, as in locations/-
+func (s *Server) list(w http.ResponseWriter, r *http.Request, collectionPath string) {
+	paths := []string{}
+	for existing := range s.collections {
+		if matchWildcard(collectionPath, existing) {
+			paths = append(paths, existing)
+		}
+	}
+	sort.Strings(paths)
+
+	// Resource Manager lists the children of the parent given as query parameter
+	parent := r.URL.Query().Get("parent")
+	items := []interface{}{}
+	for _, existing := range paths {
+		c := s.collections[existing]
+		for _, name := range c.names {
+			if parent == "" || c.items[name]["parent"] == parent {
+				items = append(items, c.items[name])
+			}
+		}
+	}
+
+	offset, end, nextPageToken, err := s.page(r, len(items))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid")
+		return
+	}
+	response := map[string]interface{}{listField(collectionPath): items[offset:end]}
+	if nextPageToken != "" {
+		response["nextPageToken"] = nextPageToken
+	}
+	writeJSON(w, response)
+}
+
+// search - serves a Resource Manager search. The query is a space separated list of field:value terms, items
+// matching any of the terms are returned, as the real API does.
+func (s *Server) search(w http.ResponseWriter, r *http.Request, collectionPath string) {
+	terms := strings.Fields(r.URL.Query().Get("query"))
+	items := []interface{}{}
+	if c, exists := s.collections[collectionPath]; exists {
+		for _, name := range c.names {
+			matched := len(terms) == 0
+			for _, term := range terms {
+				field, value, _ := strings.Cut(term, ":")
+				matched = matched || c.items[name][field] == value
+			}
+			if matched {
+				items = append(items, c.items[name])
+			}
+		}
+	}
+
+	offset, end, nextPageToken, err := s.page(r, len(items))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid")
+		return
+	}
+	response := map[string]interface{}{"projects": items[offset:end]}
+	if nextPageToken != "" {
+		response["nextPageToken"] = nextPageToken
+	}
+	writeJSON(w, response)
+}
+
+// aggregatedList - serves a compute aggregated list, the items of every zone and region of the project grouped by scope
+func (s *Server) aggregatedList(w http.ResponseWriter, r *http.Request, projectPath, collectionName string) {
+	paths := []string{}
+	for existing := range s.collections {
+		if matchWildcard(projectPath+"/zones/-/"+collectionName, existing) || matchWildcard(projectPath+"/regions/-/"+collectionName, existing) {
+			paths = append(paths, existing)
+		}
+	}
+	sort.Strings(paths)
+
+	type scopedItem struct {
+		scope string
+		item  map[string]interface{}
+	}
+	items := []scopedItem{}
+	for _, existing := range paths {
+		scope := strings.TrimPrefix(path.Dir(existing), projectPath+"/")
+		c := s.collections[existing]
+		for _, name := range c.names {
+			items = append(items, scopedItem{scope: scope, item: c.items[name]})
+		}
+	}
+
+	offset, end, nextPageToken, err := s.page(r, len(items))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid")
+		return
+	}
+	scopes := map[string]map[string][]interface{}{}
+	for _, scoped := range items[offset:end] {
+		if scopes[scoped.scope] == nil {
+			scopes[scoped.scope] = map[string][]interface{}{collectionName: {}}
+		}
+		scopes[scoped.scope][collectionName] = append(scopes[scoped.scope][collectionName], scoped.item)
+	}
+	response := map[string]interface{}{"items": scopes}
+	if nextPageToken != "" {
+		response["nextPageToken"] = nextPageToken
+	}
+	writeJSON(w, response)
+}
+
+// page - bounds of the requested page of a list of count items, and the token of the next page if there is one
+func (s *Server) page(r *http.Request, count int) (int, int, string, error) {
+	if s.PageSize <= 0 {
+		return 0, count, "", nil
+	}
+	offset := 0
+	if token := r.URL.Query().Get("pageToken"); token != "" {
+		var err error
+		if offset, err = strconv.Atoi(token); err != nil || offset > count {
+			return 0, 0, "", fmt.Errorf("invalid page token %v", token)
+		}
+	}
+	end := offset + s.PageSize
+	if end >= count {
+		return offset, count, "", nil
+	}
+	return offset, end, strconv.Itoa(end), nil
+}
+
+func (s *Server) get(w http.ResponseWriter, collectionPath, name string) {
+	c, exists := s.collections[collectionPath]
+	if !exists || c.items[name] == nil {
+		writeError(w, http.StatusNotFound, "notFound")
+		return
+	}
+	writeJSON(w, c.items[name])
+}
+
+func (s *Server) delete(w http.ResponseWriter, itemPath, collectionPath, name string) {
+	c, exists := s.collections[collectionPath]
+	if !exists || c.items[name] == nil {
+		writeError(w, http.StatusNotFound, "notFound")
+		return
+	}
+	if pattern, blocked := s.blockers[itemPath]; blocked && s.hasItems(pattern) {
+		writeError(w, http.StatusBadRequest, "resourceInUseByAnotherResource")
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(itemPath, Storage), strings.HasPrefix(itemPath, BigQuery):
+		c.remove(name)
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasPrefix(itemPath, SecretManager):
+		c.remove(name)
+		writeJSON(w, map[string]interface{}{})
+	case collectionPath == CloudResourceManager+"/liens":
+		c.remove(name)
+		writeJSON(w, map[string]interface{}{})
+	case collectionPath == CloudResourceManager+"/projects":
+		// Deleted projects are kept for 30 days, marked for deletion
+		c.items[name]["state"] = "DELETE_REQUESTED"
+		writeJSON(w, s.newOperation(path.Dir(collectionPath), ""))
+	default:
+		errorCode := s.failure(itemPath)
+		if errorCode == "" {
+			c.remove(name)
+		}
+		writeJSON(w, s.newOperation(path.Dir(collectionPath), errorCode))
+	}
+}
+
+func (s *Server) update(w http.ResponseWriter, r *http.Request, collectionPath, name string) {
+	c, exists := s.collections[collectionPath]
+	if !exists || c.items[name] == nil {
+		writeError(w, http.StatusNotFound, "notFound")
+		return
+	}
+	update := map[string]interface{}{}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid")
+		return
+	}
+
+	if strings.HasPrefix(collectionPath, Storage) {
+		for key, value := range update {
+			c.items[name][key] = value
+		}
+		writeJSON(w, c.items[name])
+		return
+	}
+	errorCode := s.failure(collectionPath + "/" + name)
+	if errorCode == "" {
+		for key, value := range update {
+			c.items[name][key] = value
+		}
+	}
+	writeJSON(w, s.newOperation(path.Dir(collectionPath), errorCode))
+}
+
+func (s *Server) action(w http.ResponseWriter, r *http.Request, itemPath, verb string) {
+	collectionPath, name := path.Split(itemPath)
+	collectionPath = strings.TrimSuffix(collectionPath, "/")
+	c, exists := s.collections[collectionPath]
+	if !exists || c.items[name] == nil {
+		writeError(w, http.StatusNotFound, "notFound")
+		return
+	}
+
+	errorCode := s.failure(itemPath)
+	if verb == "removePeering" && errorCode == "" {
+		request := struct {
+			Name string `json:"name"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&request)
+		peerings, _ := c.items[name]["peerings"].([]interface{})
+		remaining := []interface{}{}
+		for _, peering := range peerings {
+			if peeringMap, ok := peering.(map[string]interface{}); ok && peeringMap["name"] == request.Name {
+				continue
+			}
+			remaining = append(remaining, peering)
+		}
+		c.items[name]["peerings"] = remaining
+	}
+	writeJSON(w, s.newOperation(path.Dir(collectionPath), errorCode))
+}
+
+// undelete - restores a Resource Manager project marked for deletion
+func (s *Server) undelete(w http.ResponseWriter, collectionPath, name string) {
+	c, exists := s.collections[collectionPath]
+	if !exists || c.items[name] == nil {
+		writeError(w, http.StatusNotFound, "notFound")
+		return
+	}
+	if c.items[name]["state"] != "DELETE_REQUESTED" {
+		writeError(w, http.StatusBadRequest, "failedPrecondition")
+		return
+	}
+	c.items[name]["state"] = "ACTIVE"
+	writeJSON(w, s.newOperation(path.Dir(collectionPath), ""))
+}
+
+func (s *Server) hasItems(pattern string) bool {
+	for existing, c := range s.collections {
+		if matched, _ := path.Match(pattern, existing); matched && len(c.names) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// newOperation - starts an operation in scope, which fails with errorCode unless it is empty
+func (s *Server) newOperation(scope, errorCode string) map[string]interface{} {
+	s.opCounter++
+	name := fmt.Sprintf("operation-%v", s.opCounter)
+	opPath := scope + "/operations/" + name
+	op := &operation{
+		name:      name,
+		remaining: s.OperationPolls,
+		doneStyle: strings.HasPrefix(scope, CloudFunctions) || strings.HasPrefix(scope, CloudResourceManager),
+		rpcErrors: !strings.HasPrefix(scope, Compute) && !strings.HasPrefix(scope, SQLAdmin),
+		fields:    map[string]interface{}{},
+		errorCode: errorCode,
+	}
+	if op.doneStyle {
+		// Long running operations are addressed by their full relative name
+		op.name = strings.Join(strings.Split(opPath, "/")[3:], "/")
+	} else {
+		op.fields["selfLink"] = s.URL + opPath
+	}
+	if strings.HasPrefix(scope, Compute) {
+		// Compute operations link to their zone or region, global operations have neither
+		switch path.Base(path.Dir(scope)) {
+		case "zones":
+			op.fields["zone"] = s.URL + scope
+		case "regions":
+			op.fields["region"] = s.URL + scope
+		}
+	}
+	s.operations[opPath] = op
+	return op.toJSON(false)
+}
+
+// failure - error code the next operation on itemPath fails with, if any
+func (s *Server) failure(itemPath string) string {
+	failed, exists := s.failures[itemPath]
+	if !exists || failed.times <= 0 {
+		return ""
+	}
+	failed.times--
+	return failed.code
+}
+
+func (s *Server) getOperation(w http.ResponseWriter, opPath string) {
+	op, exists := s.operations[opPath]
+	if !exists {
+		writeError(w, http.StatusNotFound, "notFound")
+		return
+	}
+	done := op.remaining <= 0
+	op.remaining--
+	writeJSON(w, op.toJSON(done))
+}
+
+func (o *operation) toJSON(done bool) map[string]interface{} {
+	response := map[string]interface{}{"name": o.name}
+	for key, value := range o.fields {
+		response[key] = value
+	}
+	if o.doneStyle {
+		response["done"] = done
+	} else {
+		response["status"] = "RUNNING"
+		if done {
+			response["status"] = "DONE"
+		}
+	}
+
+	if done && o.errorCode != "" {
+		message := fmt.Sprintf("operation failed with %v", o.errorCode)
+		if o.rpcErrors {
+			response["error"] = map[string]interface{}{"code": rpcCodes[o.errorCode], "message": message}
+		} else {
+			response["error"] = map[string]interface{}{
+				"errors": []interface{}{map[string]interface{}{"code": o.errorCode, "message": message}},
+			}
+		}
+	}
+	return response
+}
+
+func matchWildcard(pattern, candidate string) bool {
+	patternSegments := strings.Split(pattern, "/")
+	candidateSegments := strings.Split(candidate, "/")
+	if len(patternSegments) != len(candidateSegments) {
+		return false
+	}
+	for i := range patternSegments {
+		if patternSegments[i] != "-" && patternSegments[i] != candidateSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// listField - name of the field holding the items of a list response
+func listField(collectionPath string) string {
+	for _, prefix := range []string{Compute, Storage, SQLAdmin} {
+		if strings.HasPrefix(collectionPath, prefix) {
+			return "items"
+		}
+	}
+	return path.Base(collectionPath)
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, code int, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": fmt.Sprintf("fake error: %v", reason),
+			"errors":  []interface{}{map[string]interface{}{"reason": reason, "message": reason}},
+		},
+	})
+}
@@ -7,8 +7,7 @@ import (
 	"golang.org/x/sync/syncmap"
 	"google.golang.org/api/bigquery/v2"
 	"log"
-	"strings"
-	"sync"
+	"time"
 )
 
 // BigQueryDatasets -
@@ -19,14 +18,7 @@ type BigQueryDatasets struct {
 }
 
 func init() {
-	bigqueryService, err := bigquery.NewService(Ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	bigqueryResource := BigQueryDatasets{
-		serviceClient: bigqueryService,
-	}
-	register(&bigqueryResource)
+	register(func() Resource { return &BigQueryDatasets{} })
 }
 
 // Name - Name of the resourceLister for BigQueryDatasets
@@ -40,39 +32,78 @@ func (c *BigQueryDatasets) ToSlice() (slice []string) {
 
 }
 
-// Setup - populates the struct
-func (c *BigQueryDatasets) Setup(config config.Config) {
+// Filtered - Items of BigQueryDatasets which were kept by a filter during the last listing
+func (c *BigQueryDatasets) Filtered() map[string]string {
+	return c.base.filteredItems()
+}
+
+// Properties - Properties of the items of BigQueryDatasets seen during the last listing, including filtered ones
+func (c *BigQueryDatasets) Properties() map[string]DefaultResourceProperties {
+	return c.base.itemProperties()
+}
+
+// Setup - populates the struct and creates the API client
+func (c *BigQueryDatasets) Setup(config config.Config) error {
 	c.base.config = config
+
+	bigqueryService, err := bigquery.NewService(config.Context, clientOptions(config, "bigquery")...)
+	if err != nil {
+		return err
+	}
+	c.serviceClient = bigqueryService
+	return nil
 }
 
 // List - Returns a list of all BigQueryDatasets
-func (c *BigQueryDatasets) List(refreshCache bool) []string {
+func (c *BigQueryDatasets) List(refreshCache bool) ([]string, error) {
 	if !refreshCache {
-		return c.ToSlice()
+		return c.ToSlice(), nil
 	}
 	// Refresh resource map
-	c.resourceMap = sync.Map{}
+	helpers.ClearSyncMap(&c.resourceMap)
+	c.base.resetFiltered()
 
 	// List all buckets in a project
-	datasetsListCall := c.serviceClient.Datasets.List(c.base.config.Project)
-	datasetsList, err := datasetsListCall.Do()
+	err := c.serviceClient.Datasets.List(c.base.config.Project).Pages(c.base.config.Context, func(datasetsList *bigquery.DatasetList) error {
+		for _, dataset := range datasetsList.Datasets {
+			datasetID := dataset.DatasetReference.DatasetId
+			if !itemLocationSelected(c.base.config, dataset.Location) {
+				continue
+			}
+			// The creation time is not part of the list response
+			datasetCall := c.serviceClient.Datasets.Get(c.base.config.Project, datasetID)
+			datasetDetails, err := datasetCall.Context(c.base.config.Context).Do()
+			if err != nil {
+				return err
+			}
+			created := time.Time{}
+			if datasetDetails.CreationTime != 0 {
+				created = time.UnixMilli(datasetDetails.CreationTime)
+			}
+			instanceResource := DefaultResourceProperties{
+				region:  dataset.Location,
+				labels:  dataset.Labels,
+				created: created,
+			}
+			if c.base.filtered(c.Name(), datasetID, instanceResource) {
+				continue
+			}
+			c.resourceMap.Store(datasetID, instanceResource)
+		}
+		return nil
+	})
 	if err != nil {
 		// check if the API is enabled/
-		if !strings.Contains(err.Error(), "API has not been used in project") {
-			// Otherwise, throw an error.
-			log.Fatal(err)
+		if classifyAPIError(err) != apiErrorDisabled {
+			// Otherwise, return the error.
+			return nil, err
 		} else {
 			log.Println("BigQuery API not enabled. Skipping.")
-			return c.ToSlice()
+			return c.ToSlice(), nil
 		}
 	}
 
-	for _, dataset := range datasetsList.Datasets {
-		instanceResource := DefaultResourceProperties{}
-		c.resourceMap.Store(dataset.DatasetReference, instanceResource)
-	}
-
-	return c.ToSlice()
+	return c.ToSlice(), nil
 }
 
 // Dependencies - Returns a List of resource names to check for
@@ -80,6 +111,11 @@ func (c *BigQueryDatasets) Dependencies() []string {
 	return []string{}
 }
 
+// Service - API service of the items of BigQueryDatasets
+func (c *BigQueryDatasets) Service() string {
+	return "bigquery.googleapis.com"
+}
+
 // Remove -
 func (c *BigQueryDatasets) Remove() error {
 
@@ -95,7 +131,7 @@ func (c *BigQueryDatasets) Remove() error {
 			// Delete the dataset
 			datasetContentsDeleteCall := c.serviceClient.Datasets.Delete(c.base.config.Project, datasetID)
 			datasetContentsDeleteCall.DeleteContents(true)
-			err := datasetContentsDeleteCall.Do()
+			err := datasetContentsDeleteCall.Context(c.base.config.Context).Do()
 			if err != nil {
 				return err
 			}
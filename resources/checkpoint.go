@@ -0,0 +1,253 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ianbrown78/gcp-nuke/config"
+	"github.com/ianbrown78/gcp-nuke/helpers"
+)
+
+// Statuses of the items in a checkpoint
+const (
+	itemPending  = "pending"
+	itemDeleting = "deleting"
+	itemDeleted  = "deleted"
+	itemFailed   = "failed"
+	itemFiltered = "filtered"
+)
+
+// checkpoint - state of a run, written to a JSON file after every change so an interrupted run can be resumed
+type checkpoint struct {
+	mutex sync.Mutex
+	path  string
+
+	Project string    `json:"project"`
+	Updated time.Time `json:"updated"`
+	// Resources - status of every item, by resource type and item name
+	Resources map[string]map[string]*checkpointItem `json:"resources"`
+	// Operations - long running operations which were started, but not seen to finish
+	Operations []*pendingOperation `json:"operations"`
+}
+
+type checkpointItem struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type pendingOperation struct {
+	operationRef
+	Description string `json:"description"`
+}
+
+type checkpointKey struct{}
+
+func newCheckpoint(path, project string) *checkpoint {
+	return &checkpoint{
+		path:       path,
+		Project:    project,
+		Resources:  make(map[string]map[string]*checkpointItem),
+		Operations: []*pendingOperation{},
+	}
+}
+
+// loadCheckpoint - reads the checkpoint written by an earlier run of project
+func loadCheckpoint(path, project string) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read checkpoint file: %v", err)
+	}
+	loaded := newCheckpoint(path, project)
+	if err := json.Unmarshal(data, loaded); err != nil {
+		return nil, fmt.Errorf("unable to parse checkpoint file %v: %v", path, err)
+	}
+	if loaded.Project != project {
+		return nil, fmt.Errorf("checkpoint file %v belongs to project %v, not %v", path, loaded.Project, project)
+	}
+	return loaded, nil
+}
+
+// withCheckpoint - attaches the checkpoint to the context of a run, so operations are recorded in it
+func withCheckpoint(ctx context.Context, runCheckpoint *checkpoint) context.Context {
+	return context.WithValue(ctx, checkpointKey{}, runCheckpoint)
+}
+
+// checkpointFrom - checkpoint of the run, nil if none is written
+func checkpointFrom(ctx context.Context) *checkpoint {
+	runCheckpoint, _ := ctx.Value(checkpointKey{}).(*checkpoint)
+	return runCheckpoint
+}
+
+// save - writes the checkpoint file, replacing it only once fully written. The caller holds the mutex.
+func (c *checkpoint) save() {
+	c.Updated = time.Now().UTC()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err == nil {
+		err = os.WriteFile(c.path+".tmp", data, 0600)
+	}
+	if err == nil {
+		err = os.Rename(c.path+".tmp", c.path)
+	}
+	if err != nil {
+		log.Printf("[Warning] Unable to write checkpoint file %v: %v", c.path, err)
+	}
+}
+
+// recordInventory - records the listed and filtered items. Items of an earlier run which are no longer listed are
+// deleted, unless listing their type failed.
+func (c *checkpoint) recordInventory(resourceMap map[string]Resource, listFailed func(name string) bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for name, resource := range resourceMap {
+		if listFailed(name) {
+			continue
+		}
+		items := c.Resources[name]
+		if items == nil {
+			items = make(map[string]*checkpointItem)
+			c.Resources[name] = items
+		}
+		for item, state := range items {
+			if state.Status != itemDeleted && !helpers.SliceContains(resource.ToSlice(), item) {
+				items[item] = &checkpointItem{Status: itemDeleted}
+			}
+		}
+		for _, item := range resource.ToSlice() {
+			items[item] = &checkpointItem{Status: itemPending}
+		}
+		for item := range resource.Filtered() {
+			items[item] = &checkpointItem{Status: itemFiltered}
+		}
+	}
+	c.save()
+}
+
+// startType - the pending items of a resource type are being deleted
+func (c *checkpoint) startType(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, state := range c.Resources[name] {
+		if state.Status == itemPending {
+			state.Status = itemDeleting
+		}
+	}
+	c.save()
+}
+
+// finishType - items of a resource type which are no longer listed are deleted, the others failed with err
+func (c *checkpoint) finishType(name string, remaining []string, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for item, state := range c.Resources[name] {
+		if state.Status != itemPending && state.Status != itemDeleting {
+			continue
+		}
+		switch {
+		case !helpers.SliceContains(remaining, item):
+			c.Resources[name][item] = &checkpointItem{Status: itemDeleted}
+		case err != nil:
+			c.Resources[name][item] = &checkpointItem{Status: itemFailed, Error: err.Error()}
+		default:
+			state.Status = itemPending
+		}
+	}
+	c.save()
+}
+
+func (c *checkpoint) addOperation(ref operationRef, description string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, pending := range c.Operations {
+		if pending.operationRef == ref {
+			return
+		}
+	}
+	c.Operations = append(c.Operations, &pendingOperation{operationRef: ref, Description: description})
+	c.save()
+}
+
+func (c *checkpoint) removeOperation(ref operationRef) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i, pending := range c.Operations {
+		if pending.operationRef == ref {
+			c.Operations = append(c.Operations[:i], c.Operations[i+1:]...)
+			c.save()
+			return
+		}
+	}
+}
+
+// pendingOperations - operations of the checkpoint which were not seen to finish
+func (c *checkpoint) pendingOperations() []pendingOperation {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	operations := []pendingOperation{}
+	for _, pending := range c.Operations {
+		operations = append(operations, *pending)
+	}
+	return operations
+}
+
+// deletedCount - number of items recorded as deleted, by resource type
+func (c *checkpoint) deletedCount() map[string]int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	counts := make(map[string]int)
+	for name, items := range c.Resources {
+		for _, state := range items {
+			if state.Status == itemDeleted {
+				counts[name]++
+			}
+		}
+	}
+	return counts
+}
+
+// resumeOperations - waits for the operations an interrupted run left pending, so their items are not deleted twice
+func resumeOperations(config config.Config, runCheckpoint *checkpoint) {
+	counts := runCheckpoint.deletedCount()
+	names := []string{}
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		log.Printf("[Resume] %v: %v items already deleted", name, counts[name])
+	}
+
+	var wg sync.WaitGroup
+	for _, pending := range runCheckpoint.pendingOperations() {
+		pending := pending
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !config.NoDryRun {
+				log.Printf("[Dryrun] Operation %v was pending: %v", pending.Name, pending.Description)
+				return
+			}
+			log.Printf("[Resume] Waiting for pending operation %v: %v", pending.Name, pending.Description)
+			operation, err := resumedOperation(config, pending.operationRef)
+			if err == nil {
+				err = waitForOperation(config, pending.Description, operation)
+			}
+			switch {
+			case err == nil:
+				log.Printf("[Resume] Operation %v completed", pending.Name)
+			case classifyAPIError(err) == apiErrorNotFound:
+				// Operations are only kept for a limited time after they finished
+				log.Printf("[Resume] Operation %v no longer exists", pending.Name)
+				runCheckpoint.removeOperation(pending.operationRef)
+			default:
+				log.Printf("[Warning] Pending operation %v did not complete, its items are deleted again: %v", pending.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,76 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ianbrown78/gcp-nuke/config"
+	"github.com/ianbrown78/gcp-nuke/helpers"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// Services - API services used by the resources, endpoints can be overridden per service
+var Services = []string{
+	"bigquery",
+	"cloudfunctions",
+	"cloudresourcemanager",
+	"compute",
+	"container",
+	"secretmanager",
+	"sqladmin",
+	"storage",
+}
+
+// ClientSettings - how the shared API client authenticates and identifies itself
+type ClientSettings struct {
+	CredentialsFile string
+	UserAgent       string
+	QuotaProject    string
+}
+
+// NewClientOptions - builds one authenticated HTTP client which all API services of a run share
+func NewClientOptions(ctx context.Context, settings ClientSettings) ([]option.ClientOption, error) {
+	options := []option.ClientOption{option.WithScopes("https://www.googleapis.com/auth/cloud-platform")}
+	if settings.CredentialsFile != "" {
+		options = append(options, option.WithCredentialsFile(settings.CredentialsFile))
+	}
+	if settings.UserAgent != "" {
+		options = append(options, option.WithUserAgent(settings.UserAgent))
+	}
+	if settings.QuotaProject != "" {
+		options = append(options, option.WithQuotaProject(settings.QuotaProject))
+	}
+
+	httpClient, _, err := htransport.NewClient(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	return []option.ClientOption{option.WithHTTPClient(httpClient)}, nil
+}
+
+// ParseEndpoints - parses service=url endpoint overrides
+func ParseEndpoints(values []string) (map[string]string, error) {
+	endpoints := make(map[string]string)
+	for _, value := range values {
+		service, endpoint, found := strings.Cut(value, "=")
+		if !found || endpoint == "" {
+			return nil, fmt.Errorf("invalid endpoint %v, expected service=url", value)
+		}
+		if !helpers.SliceContains(Services, service) {
+			return nil, fmt.Errorf("unknown service %v in endpoint %v, valid services are: %v", service, value, strings.Join(Services, ", "))
+		}
+		endpoints[service] = endpoint
+	}
+	return endpoints, nil
+}
+
+// clientOptions - options to create the client of an API service with
+func clientOptions(config config.Config, service string) []option.ClientOption {
+	options := append([]option.ClientOption{}, config.ClientOptions...)
+	if endpoint, exists := config.Endpoints[service]; exists {
+		options = append(options, option.WithEndpoint(endpoint))
+	}
+	return options
+}
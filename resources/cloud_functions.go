@@ -4,9 +4,6 @@ import (
 	"fmt"
 	"google.golang.org/api/cloudfunctions/v2"
 	"log"
-	"strings"
-	"sync"
-	"time"
 
 	"github.com/ianbrown78/gcp-nuke/config"
 	"github.com/ianbrown78/gcp-nuke/helpers"
@@ -22,14 +19,7 @@ type FunctionsInstances struct {
 }
 
 func init() {
-	functionsService, err := cloudfunctions.NewService(Ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	functionsResource := FunctionsInstances{
-		serviceClient: functionsService,
-	}
-	register(&functionsResource)
+	register(func() Resource { return &FunctionsInstances{} })
 }
 
 // Name - Name of the resourceLister for FunctionsInstances
@@ -43,51 +33,80 @@ func (c *FunctionsInstances) ToSlice() (slice []string) {
 
 }
 
-// Setup - populates the struct
-func (c *FunctionsInstances) Setup(config config.Config) {
+// Filtered - Items of FunctionsInstances which were kept by a filter during the last listing
+func (c *FunctionsInstances) Filtered() map[string]string {
+	return c.base.filteredItems()
+}
+
+// Properties - Properties of the items of FunctionsInstances seen during the last listing, including filtered ones
+func (c *FunctionsInstances) Properties() map[string]DefaultResourceProperties {
+	return c.base.itemProperties()
+}
+
+// Setup - populates the struct and creates the API client
+func (c *FunctionsInstances) Setup(config config.Config) error {
 	c.base.config = config
+
+	functionsService, err := cloudfunctions.NewService(config.Context, clientOptions(config, "cloudfunctions")...)
+	if err != nil {
+		return err
+	}
+	c.serviceClient = functionsService
+	return nil
 }
 
 // List - Returns a list of all FunctionsInstances
-func (c *FunctionsInstances) List(refreshCache bool) []string {
+func (c *FunctionsInstances) List(refreshCache bool) ([]string, error) {
 	if !refreshCache {
-		return c.ToSlice()
+		return c.ToSlice(), nil
 	}
 	// Refresh resource map
-	c.resourceMap = sync.Map{}
+	helpers.ClearSyncMap(&c.resourceMap)
+	c.base.resetFiltered()
 
 	// Get the list of locations for the project.
-	locationsListCall := c.serviceClient.Projects.Locations.List("projects/" + c.base.config.Project)
-	locationsList, err := locationsListCall.Do()
+	err := c.serviceClient.Projects.Locations.List("projects/"+c.base.config.Project).Pages(c.base.config.Context, func(locationsList *cloudfunctions.ListLocationsResponse) error {
+		// Get the list of functions by location and project.
+		for _, location := range locationsList.Locations {
+			// Functions of other regions are not listed at all
+			if !itemLocationSelected(c.base.config, location.LocationId) {
+				continue
+			}
+			parent := "projects/" + c.base.config.Project + "/locations/" + location.LocationId
+			err := c.serviceClient.Projects.Locations.Functions.List(parent).Pages(c.base.config.Context, func(functionsList *cloudfunctions.ListFunctionsResponse) error {
+				// Add functions to the resourceMap.
+				for _, function := range functionsList.Functions {
+					// Only the last update time is known, which is never before the creation
+					instanceResource := DefaultResourceProperties{
+						zone:            location.LocationId,
+						labels:          function.Labels,
+						created:         parseCreationTime(function.UpdateTime),
+						createdIsUpdate: true,
+					}
+					if c.base.filtered(c.Name(), function.Name, instanceResource) {
+						continue
+					}
+					c.resourceMap.Store(function.Name, instanceResource)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		// check if the API is enabled/
-		if !strings.Contains(err.Error(), "API has not been used in project") {
-			// Otherwise, throw an error.
-			log.Fatal(err)
+		if classifyAPIError(err) != apiErrorDisabled {
+			// Otherwise, return the error.
+			return nil, err
 		} else {
-			log.Printf("SQLAdmin API not enabled in project %v. Skipping.", c.base.config.Project)
-			return c.ToSlice()
-		}
-	}
-
-	// Get the list of functions by location and project.
-	for _, location := range locationsList.Locations {
-		functionsListCall := c.serviceClient.Projects.Locations.Functions.List(
-			"projects/" + c.base.config.Project + "/locations/" + location.LocationId)
-		functionsList, err := functionsListCall.Do()
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// Add functions to the resourceMap.
-		for _, function := range functionsList.Functions {
-			instanceResource := DefaultResourceProperties{
-				zone: location.LocationId,
-			}
-			c.resourceMap.Store(function.Name, instanceResource)
+			log.Printf("Cloud Functions API not enabled in project %v. Skipping.", c.base.config.Project)
+			return c.ToSlice(), nil
 		}
 	}
-	return c.ToSlice()
+	return c.ToSlice(), nil
 }
 
 // Dependencies - Returns a List of resource names to check for
@@ -95,6 +114,11 @@ func (c *FunctionsInstances) Dependencies() []string {
 	return []string{}
 }
 
+// Service - API service of the items of FunctionsInstances
+func (c *FunctionsInstances) Service() string {
+	return "cloudfunctions.googleapis.com"
+}
+
 // Remove -
 func (c *FunctionsInstances) Remove() error {
 
@@ -107,35 +131,19 @@ func (c *FunctionsInstances) Remove() error {
 
 		// Parallel instance deletion
 		errs.Go(func() error {
-			deleteCall := c.serviceClient.Projects.Locations.Functions.Delete(
-				"projects/" + c.base.config.Project +
-					"/locations/" + location +
-					"/functions/" + functionID)
-			operation, err := deleteCall.Do()
+			// Function names are the full resource name, projects/p/locations/l/functions/f
+			deleteCall := c.serviceClient.Projects.Locations.Functions.Delete(functionID)
+			operation, err := deleteCall.Context(c.base.config.Context).Do()
 			if err != nil {
 				return err
 			}
-			var opStatus string
-			seconds := 0
-			for opStatus != "DONE" {
-				log.Printf("[Info] Resource currently being deleted %v [type: %v project: %v region: %v] (%v seconds)", functionID, c.Name(), c.base.config.Project, location, seconds)
-
-				operationCall := c.serviceClient.Projects.Locations.Operations.Get(operation.Name)
-				checkOpp, err := operationCall.Do()
-				if err != nil {
-					return err
-				}
-				opStatus = string(checkOpp.Response)
-
-				time.Sleep(time.Duration(c.base.config.PollTime) * time.Second)
-				seconds += c.base.config.PollTime
-				if seconds > c.base.config.Timeout {
-					return fmt.Errorf("[Error] Resource deletion timed out for %v [type: %v project: %v region: %v] (%v seconds)", functionID, c.Name(), c.base.config.Project, location, c.base.config.Timeout)
-				}
+			err = waitForOperation(c.base.config, fmt.Sprintf("deletion of %v [type: %v project: %v region: %v]", functionID, c.Name(), c.base.config.Project, location), functionsOperation(c.serviceClient, operation))
+			if err != nil {
+				return err
 			}
 			c.resourceMap.Delete(functionID)
 
-			log.Printf("[Info] Resource deleted %v [type: %v project: %v region: %v] (%v seconds)", functionID, c.Name(), c.base.config.Project, location, seconds)
+			log.Printf("[Info] Resource deleted %v [type: %v project: %v region: %v]", functionID, c.Name(), c.base.config.Project, location)
 			return nil
 		})
 
@@ -3,8 +3,6 @@ package resources
 import (
 	"fmt"
 	"log"
-	"sync"
-	"time"
 
 	"github.com/ianbrown78/gcp-nuke/config"
 	"github.com/ianbrown78/gcp-nuke/helpers"
@@ -21,14 +19,7 @@ type ComputeFirewalls struct {
 }
 
 func init() {
-	computeService, err := compute.NewService(Ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	computeResource := ComputeFirewalls{
-		serviceClient: computeService,
-	}
-	register(&computeResource)
+	register(func() Resource { return &ComputeFirewalls{} })
 }
 
 // Name - Name of the resourceLister for ComputeFirewalls
@@ -42,30 +33,57 @@ func (c *ComputeFirewalls) ToSlice() (slice []string) {
 
 }
 
-// Setup - populates the struct
-func (c *ComputeFirewalls) Setup(config config.Config) {
+// Filtered - Items of ComputeFirewalls which were kept by a filter during the last listing
+func (c *ComputeFirewalls) Filtered() map[string]string {
+	return c.base.filteredItems()
+}
+
+// Properties - Properties of the items of ComputeFirewalls seen during the last listing, including filtered ones
+func (c *ComputeFirewalls) Properties() map[string]DefaultResourceProperties {
+	return c.base.itemProperties()
+}
+
+// Setup - populates the struct and creates the API client
+func (c *ComputeFirewalls) Setup(config config.Config) error {
 	c.base.config = config
 
+	computeService, err := compute.NewService(config.Context, clientOptions(config, "compute")...)
+	if err != nil {
+		return err
+	}
+	c.serviceClient = computeService
+	return nil
 }
 
 // List - Returns a list of all ComputeFirewalls
-func (c *ComputeFirewalls) List(refreshCache bool) []string {
+func (c *ComputeFirewalls) List(refreshCache bool) ([]string, error) {
 	if !refreshCache {
-		return c.ToSlice()
+		return c.ToSlice(), nil
 	}
 	// Refresh resource map
-	c.resourceMap = sync.Map{}
+	helpers.ClearSyncMap(&c.resourceMap)
+	c.base.resetFiltered()
 
-	firewallListCall := c.serviceClient.Firewalls.List(c.base.config.Project)
-	firewallList, err := firewallListCall.Do()
+	err := c.serviceClient.Firewalls.List(c.base.config.Project).Pages(c.base.config.Context, func(firewallList *compute.FirewallList) error {
+		for _, firewall := range firewallList.Items {
+			instanceResource := DefaultResourceProperties{
+				created: parseCreationTime(firewall.CreationTimestamp),
+			}
+			if c.base.filtered(c.Name(), firewall.Name, instanceResource) {
+				continue
+			}
+			c.resourceMap.Store(firewall.Name, instanceResource)
+		}
+		return nil
+	})
 	if err != nil {
-		log.Fatal(err)
-	}
-
-	for _, firewall := range firewallList.Items {
-		c.resourceMap.Store(firewall.Name, nil)
+		if classifyAPIError(err) == apiErrorDisabled {
+			log.Println("Compute Engine API not enabled. Skipping.")
+			return c.ToSlice(), nil
+		}
+		return nil, err
 	}
-	return c.ToSlice()
+	return c.ToSlice(), nil
 }
 
 // Dependencies - Returns a List of resource names to check for
@@ -76,6 +94,11 @@ func (c *ComputeFirewalls) Dependencies() []string {
 	return []string{a.Name(), b.Name(), cl.Name()}
 }
 
+// Service - API service of the items of ComputeFirewalls
+func (c *ComputeFirewalls) Service() string {
+	return "compute.googleapis.com"
+}
+
 // Remove -
 func (c *ComputeFirewalls) Remove() error {
 
@@ -88,31 +111,17 @@ func (c *ComputeFirewalls) Remove() error {
 		// Parallel firewall deletion
 		errs.Go(func() error {
 			deleteCall := c.serviceClient.Firewalls.Delete(c.base.config.Project, firewallID)
-			operation, err := deleteCall.Do()
+			operation, err := deleteCall.Context(c.base.config.Context).Do()
 			if err != nil {
 				return err
 			}
-			var opStatus string
-			seconds := 0
-			for opStatus != "DONE" {
-				log.Printf("[Info] Resource currently being deleted %v [type: %v project: %v] (%v seconds)", firewallID, c.Name(), c.base.config.Project, seconds)
-
-				operationCall := c.serviceClient.GlobalOperations.Get(c.base.config.Project, operation.Name)
-				checkOpp, err := operationCall.Do()
-				if err != nil {
-					return err
-				}
-				opStatus = checkOpp.Status
-
-				time.Sleep(time.Duration(c.base.config.PollTime) * time.Second)
-				seconds += c.base.config.PollTime
-				if seconds > c.base.config.Timeout {
-					return fmt.Errorf("[Error] Resource deletion timed out for %v [type: %v project: %v] (%v seconds)", firewallID, c.Name(), c.base.config.Project, c.base.config.Timeout)
-				}
+			err = waitForOperation(c.base.config, fmt.Sprintf("deletion of %v [type: %v project: %v]", firewallID, c.Name(), c.base.config.Project), computeOperation(c.serviceClient, c.base.config.Project, operation))
+			if err != nil {
+				return err
 			}
 			c.resourceMap.Delete(firewallID)
 
-			log.Printf("[Info] Resource deleted %v [type: %v project: %v] (%v seconds)", firewallID, c.Name(), c.base.config.Project, seconds)
+			log.Printf("[Info] Resource deleted %v [type: %v project: %v]", firewallID, c.Name(), c.base.config.Project)
 			return nil
 		})
 		return true
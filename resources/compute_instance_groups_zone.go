@@ -3,35 +3,26 @@ package resources
 import (
 	"fmt"
 	"log"
-	"reflect"
-	"sync"
-	"time"
 
 	"github.com/ianbrown78/gcp-nuke/config"
 	"github.com/ianbrown78/gcp-nuke/helpers"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/syncmap"
 	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/container/v1"
 )
 
 // ComputeInstanceGroupsZone -
 type ComputeInstanceGroupsZone struct {
 	serviceClient *compute.Service
 	// Required to skip gke nodepools
-	gkeInstanceGroups []string
-	base              ResourceBase
-	resourceMap       syncmap.Map
+	gkeClient   *container.Service
+	base        ResourceBase
+	resourceMap syncmap.Map
 }
 
 func init() {
-	computeService, err := compute.NewService(Ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	computeResource := ComputeInstanceGroupsZone{
-		serviceClient: computeService,
-	}
-	register(&computeResource)
+	register(func() Resource { return &ComputeInstanceGroupsZone{} })
 }
 
 // Name - Name of the resourceLister for ComputeInstanceGroupsZone
@@ -45,47 +36,80 @@ func (c *ComputeInstanceGroupsZone) ToSlice() (slice []string) {
 
 }
 
-// Setup - populates the struct
-func (c *ComputeInstanceGroupsZone) Setup(config config.Config) {
+// Filtered - Items of ComputeInstanceGroupsZone which were kept by a filter during the last listing
+func (c *ComputeInstanceGroupsZone) Filtered() map[string]string {
+	return c.base.filteredItems()
+}
+
+// Properties - Properties of the items of ComputeInstanceGroupsZone seen during the last listing, including filtered ones
+func (c *ComputeInstanceGroupsZone) Properties() map[string]DefaultResourceProperties {
+	return c.base.itemProperties()
+}
+
+// Setup - populates the struct and creates the API clients
+func (c *ComputeInstanceGroupsZone) Setup(config config.Config) error {
 	c.base.config = config
 
-	// Get the node pool list with some reflection rather than re-instantiating
-	a := ContainerGKEClusters{}
-	gkeResource := resourceMap[a.Name()]
-	gkeInstance := reflect.ValueOf(gkeResource).Elem().Addr().Interface().(*ContainerGKEClusters)
-	gkeInstance.Setup(config)
-	gkeInstance.List(true)
-	c.gkeInstanceGroups = gkeInstance.InstanceGroups
+	computeService, err := compute.NewService(config.Context, clientOptions(config, "compute")...)
+	if err != nil {
+		return err
+	}
+	c.serviceClient = computeService
+
+	containerService, err := container.NewService(config.Context, clientOptions(config, "container")...)
+	if err != nil {
+		return err
+	}
+	c.gkeClient = containerService
+	return nil
 }
 
 // List - Returns a list of all ComputeInstanceGroupsZone
-func (c *ComputeInstanceGroupsZone) List(refreshCache bool) []string {
+func (c *ComputeInstanceGroupsZone) List(refreshCache bool) ([]string, error) {
 	if !refreshCache {
-		return c.ToSlice()
+		return c.ToSlice(), nil
 	}
 	// Refresh resource map
-	c.resourceMap = sync.Map{}
+	helpers.ClearSyncMap(&c.resourceMap)
+	c.base.resetFiltered()
 
-	for _, zone := range c.base.config.Zones {
-		instanceListCall := c.serviceClient.InstanceGroupManagers.List(c.base.config.Project, zone)
-		instanceList, err := instanceListCall.Do()
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		for _, instance := range instanceList.Items {
+	gkeInstanceGroups, err := gkeNodePoolInstanceGroups(c.base.config.Context, c.gkeClient, c.base.config.Project)
+	if err != nil {
+		return nil, err
+	}
 
-			if helpers.SliceContains(c.gkeInstanceGroups, instance.Name) {
+	err = c.serviceClient.InstanceGroupManagers.AggregatedList(c.base.config.Project).Pages(c.base.config.Context, func(aggregatedList *compute.InstanceGroupManagerAggregatedList) error {
+		for scope, scopedList := range aggregatedList.Items {
+			kind, zone := aggregatedScope(scope)
+			if kind != "zones" || !locationSelected(c.base.config.Zones, zone) {
 				continue
 			}
+			for _, instance := range scopedList.InstanceGroupManagers {
+
+				if helpers.SliceContains(gkeInstanceGroups, instance.Name) {
+					continue
+				}
 
-			instanceResource := DefaultResourceProperties{
-				zone: zone,
+				instanceResource := DefaultResourceProperties{
+					zone:    zone,
+					created: parseCreationTime(instance.CreationTimestamp),
+				}
+				if c.base.filtered(c.Name(), instance.Name, instanceResource) {
+					continue
+				}
+				c.resourceMap.Store(instance.Name, instanceResource)
 			}
-			c.resourceMap.Store(instance.Name, instanceResource)
 		}
+		return nil
+	})
+	if err != nil {
+		if classifyAPIError(err) == apiErrorDisabled {
+			log.Println("Compute Engine API not enabled. Skipping.")
+			return c.ToSlice(), nil
+		}
+		return nil, err
 	}
-	return c.ToSlice()
+	return c.ToSlice(), nil
 }
 
 // Dependencies - Returns a List of resource names to check for
@@ -94,6 +118,11 @@ func (c *ComputeInstanceGroupsZone) Dependencies() []string {
 	return []string{a.Name()}
 }
 
+// Service - API service of the items of ComputeInstanceGroupsZone
+func (c *ComputeInstanceGroupsZone) Service() string {
+	return "compute.googleapis.com"
+}
+
 // Remove -
 func (c *ComputeInstanceGroupsZone) Remove() error {
 
@@ -107,31 +136,17 @@ func (c *ComputeInstanceGroupsZone) Remove() error {
 		// Parallel instance deletion
 		errs.Go(func() error {
 			deleteCall := c.serviceClient.InstanceGroupManagers.Delete(c.base.config.Project, zone, instanceID)
-			operation, err := deleteCall.Do()
+			operation, err := deleteCall.Context(c.base.config.Context).Do()
 			if err != nil {
 				return err
 			}
-			var opStatus string
-			seconds := 0
-			for opStatus != "DONE" {
-				log.Printf("[Info] Resource currently being deleted %v [type: %v project: %v zone: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, zone, seconds)
-
-				operationCall := c.serviceClient.ZoneOperations.Get(c.base.config.Project, zone, operation.Name)
-				checkOpp, err := operationCall.Do()
-				if err != nil {
-					return err
-				}
-				opStatus = checkOpp.Status
-
-				time.Sleep(time.Duration(c.base.config.PollTime) * time.Second)
-				seconds += c.base.config.PollTime
-				if seconds > c.base.config.Timeout {
-					return fmt.Errorf("[Error] Resource deletion timed out for %v [type: %v project: %v zone: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, zone, c.base.config.Timeout)
-				}
+			err = waitForOperation(c.base.config, fmt.Sprintf("deletion of %v [type: %v project: %v zone: %v]", instanceID, c.Name(), c.base.config.Project, zone), computeOperation(c.serviceClient, c.base.config.Project, operation))
+			if err != nil {
+				return err
 			}
 			c.resourceMap.Delete(instanceID)
 
-			log.Printf("[Info] Resource deleted %v [type: %v project: %v zone: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, zone, seconds)
+			log.Printf("[Info] Resource deleted %v [type: %v project: %v zone: %v]", instanceID, c.Name(), c.base.config.Project, zone)
 			return nil
 		})
 		return true
@@ -3,8 +3,6 @@ package resources
 import (
 	"fmt"
 	"log"
-	"sync"
-	"time"
 
 	"github.com/ianbrown78/gcp-nuke/config"
 	"github.com/ianbrown78/gcp-nuke/helpers"
@@ -21,14 +19,7 @@ type ComputeInstanceTemplates struct {
 }
 
 func init() {
-	computeService, err := compute.NewService(Ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	computeResource := ComputeInstanceTemplates{
-		serviceClient: computeService,
-	}
-	register(&computeResource)
+	register(func() Resource { return &ComputeInstanceTemplates{} })
 }
 
 // Name - Name of the resourceLister for ComputeInstanceTemplates
@@ -42,31 +33,58 @@ func (c *ComputeInstanceTemplates) ToSlice() (slice []string) {
 
 }
 
-// Setup - populates the struct
-func (c *ComputeInstanceTemplates) Setup(config config.Config) {
+// Filtered - Items of ComputeInstanceTemplates which were kept by a filter during the last listing
+func (c *ComputeInstanceTemplates) Filtered() map[string]string {
+	return c.base.filteredItems()
+}
+
+// Properties - Properties of the items of ComputeInstanceTemplates seen during the last listing, including filtered ones
+func (c *ComputeInstanceTemplates) Properties() map[string]DefaultResourceProperties {
+	return c.base.itemProperties()
+}
+
+// Setup - populates the struct and creates the API client
+func (c *ComputeInstanceTemplates) Setup(config config.Config) error {
 	c.base.config = config
 
+	computeService, err := compute.NewService(config.Context, clientOptions(config, "compute")...)
+	if err != nil {
+		return err
+	}
+	c.serviceClient = computeService
+	return nil
 }
 
 // List - Returns a list of all ComputeInstanceTemplates
-func (c *ComputeInstanceTemplates) List(refreshCache bool) []string {
+func (c *ComputeInstanceTemplates) List(refreshCache bool) ([]string, error) {
 	if !refreshCache {
-		return c.ToSlice()
+		return c.ToSlice(), nil
 	}
 	// Refresh resource map
-	c.resourceMap = sync.Map{}
-
-	instanceListCall := c.serviceClient.InstanceTemplates.List(c.base.config.Project)
-	instanceList, err := instanceListCall.Do()
+	helpers.ClearSyncMap(&c.resourceMap)
+	c.base.resetFiltered()
+
+	err := c.serviceClient.InstanceTemplates.List(c.base.config.Project).Pages(c.base.config.Context, func(instanceList *compute.InstanceTemplateList) error {
+		for _, instance := range instanceList.Items {
+			instanceResource := DefaultResourceProperties{
+				labels:  instance.Properties.Labels,
+				created: parseCreationTime(instance.CreationTimestamp),
+			}
+			if c.base.filtered(c.Name(), instance.Name, instanceResource) {
+				continue
+			}
+			c.resourceMap.Store(instance.Name, instanceResource)
+		}
+		return nil
+	})
 	if err != nil {
-		log.Fatal(err)
-	}
-
-	for _, instance := range instanceList.Items {
-		instanceResource := DefaultResourceProperties{}
-		c.resourceMap.Store(instance.Name, instanceResource)
+		if classifyAPIError(err) == apiErrorDisabled {
+			log.Println("Compute Engine API not enabled. Skipping.")
+			return c.ToSlice(), nil
+		}
+		return nil, err
 	}
-	return c.ToSlice()
+	return c.ToSlice(), nil
 }
 
 // Dependencies - Returns a List of resource names to check for
@@ -77,6 +95,11 @@ func (c *ComputeInstanceTemplates) Dependencies() []string {
 	return []string{a.Name(), b.Name(), cl.Name()}
 }
 
+// Service - API service of the items of ComputeInstanceTemplates
+func (c *ComputeInstanceTemplates) Service() string {
+	return "compute.googleapis.com"
+}
+
 // Remove -
 func (c *ComputeInstanceTemplates) Remove() error {
 
@@ -89,30 +112,17 @@ func (c *ComputeInstanceTemplates) Remove() error {
 		// Parallel instance deletion
 		errs.Go(func() error {
 			deleteCall := c.serviceClient.InstanceTemplates.Delete(c.base.config.Project, instanceID)
-			operation, err := deleteCall.Do()
+			operation, err := deleteCall.Context(c.base.config.Context).Do()
 			if err != nil {
 				return err
 			}
-			var opStatus string
-			seconds := 0
-			for opStatus != "DONE" {
-				log.Printf("[Info] Resource currently being deleted %v [type: %v project: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, seconds)
-				operationCall := c.serviceClient.GlobalOperations.Get(c.base.config.Project, operation.Name)
-				checkOpp, err := operationCall.Do()
-				if err != nil {
-					return err
-				}
-				opStatus = checkOpp.Status
-
-				time.Sleep(time.Duration(c.base.config.PollTime) * time.Second)
-				seconds += c.base.config.PollTime
-				if seconds > c.base.config.Timeout {
-					return fmt.Errorf("[Error] Resource deletion timed out for %v [type: %v project: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, c.base.config.Timeout)
-				}
+			err = waitForOperation(c.base.config, fmt.Sprintf("deletion of %v [type: %v project: %v]", instanceID, c.Name(), c.base.config.Project), computeOperation(c.serviceClient, c.base.config.Project, operation))
+			if err != nil {
+				return err
 			}
 			c.resourceMap.Delete(instanceID)
 
-			log.Printf("[Info] Resource deleted %v [type: %v project: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, seconds)
+			log.Printf("[Info] Resource deleted %v [type: %v project: %v]", instanceID, c.Name(), c.base.config.Project)
 			return nil
 		})
 		return true
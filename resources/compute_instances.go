@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"log"
 	"strings"
-	"sync"
-	"time"
 
 	"github.com/ianbrown78/gcp-nuke/config"
 	"github.com/ianbrown78/gcp-nuke/helpers"
@@ -22,14 +20,7 @@ type ComputeInstances struct {
 }
 
 func init() {
-	computeService, err := compute.NewService(Ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	computeResource := ComputeInstances{
-		serviceClient: computeService,
-	}
-	register(&computeResource)
+	register(func() Resource { return &ComputeInstances{} })
 }
 
 // Name - Name of the resourceLister for ComputeInstances
@@ -43,53 +34,84 @@ func (c *ComputeInstances) ToSlice() (slice []string) {
 
 }
 
-// Setup - populates the struct
-func (c *ComputeInstances) Setup(config config.Config) {
+// Filtered - Items of ComputeInstances which were kept by a filter during the last listing
+func (c *ComputeInstances) Filtered() map[string]string {
+	return c.base.filteredItems()
+}
+
+// Properties - Properties of the items of ComputeInstances seen during the last listing, including filtered ones
+func (c *ComputeInstances) Properties() map[string]DefaultResourceProperties {
+	return c.base.itemProperties()
+}
+
+// Setup - populates the struct and creates the API client
+func (c *ComputeInstances) Setup(config config.Config) error {
 	c.base.config = config
 
+	computeService, err := compute.NewService(config.Context, clientOptions(config, "compute")...)
+	if err != nil {
+		return err
+	}
+	c.serviceClient = computeService
+	return nil
 }
 
 // List - Returns a list of all ComputeInstances
-func (c *ComputeInstances) List(refreshCache bool) []string {
+func (c *ComputeInstances) List(refreshCache bool) ([]string, error) {
 	if !refreshCache {
-		return c.ToSlice()
+		return c.ToSlice(), nil
 	}
 	// Refresh resource map
-	c.resourceMap = sync.Map{}
-
-	for _, zone := range c.base.config.Zones {
-		instanceListCall := c.serviceClient.Instances.List(c.base.config.Project, zone)
-		instanceList, err := instanceListCall.Do()
-		if err != nil {
-			// check if the API is enabled/
-			if !strings.Contains(err.Error(), "API has not been used in project") {
-				// Otherwise, throw an error.
-				log.Fatal(err)
-			} else {
-				log.Println("Compute Engine API not enabled. Skipping.")
-				return c.ToSlice()
-			}
-		}
+	helpers.ClearSyncMap(&c.resourceMap)
+	c.base.resetFiltered()
 
-		for _, instance := range instanceList.Items {
-			skipInstance := false
-			// Skip any managed by instance groups
-			for _, item := range instance.Metadata.Items {
-				if item.Key == "created-by" && strings.Contains(*item.Value, "/instanceGroupManagers/") {
-					skipInstance = true
-				}
-			}
-			if skipInstance {
+	err := c.serviceClient.Instances.AggregatedList(c.base.config.Project).Pages(c.base.config.Context, func(aggregatedList *compute.InstanceAggregatedList) error {
+		for scope, scopedList := range aggregatedList.Items {
+			kind, zone := aggregatedScope(scope)
+			if kind != "zones" || !locationSelected(c.base.config.Zones, zone) {
 				continue
 			}
+			for _, instance := range scopedList.Instances {
+				skipInstance := false
+				// Skip any managed by instance groups
+				for _, item := range instance.Metadata.Items {
+					if item.Key == "created-by" && strings.Contains(*item.Value, "/instanceGroupManagers/") {
+						skipInstance = true
+					}
+				}
+				if skipInstance {
+					continue
+				}
 
-			instanceResource := DefaultResourceProperties{
-				zone: zone,
+				instanceResource := DefaultResourceProperties{
+					zone:      zone,
+					protected: instance.DeletionProtection,
+					labels:    instance.Labels,
+					created:   parseCreationTime(instance.CreationTimestamp),
+				}
+				// Size of the attached disks
+				for _, disk := range instance.Disks {
+					instanceResource.sizeBytes += disk.DiskSizeGb * gibibyte
+				}
+				if c.base.filtered(c.Name(), instance.Name, instanceResource) {
+					continue
+				}
+				c.resourceMap.Store(instance.Name, instanceResource)
 			}
-			c.resourceMap.Store(instance.Name, instanceResource)
+		}
+		return nil
+	})
+	if err != nil {
+		// check if the API is enabled/
+		if classifyAPIError(err) != apiErrorDisabled {
+			// Otherwise, return the error.
+			return nil, err
+		} else {
+			log.Println("Compute Engine API not enabled. Skipping.")
+			return c.ToSlice(), nil
 		}
 	}
-	return c.ToSlice()
+	return c.ToSlice(), nil
 }
 
 // Dependencies - Returns a List of resource names to check for
@@ -97,6 +119,11 @@ func (c *ComputeInstances) Dependencies() []string {
 	return []string{}
 }
 
+// Service - API service of the items of ComputeInstances
+func (c *ComputeInstances) Service() string {
+	return "compute.googleapis.com"
+}
+
 // Remove -
 func (c *ComputeInstances) Remove() error {
 
@@ -110,45 +137,34 @@ func (c *ComputeInstances) Remove() error {
 		// Parallel instance deletion
 		errs.Go(func() error {
 			getInstanceCall := c.serviceClient.Instances.Get(c.base.config.Project, zone, instanceID)
-			getOp, err := getInstanceCall.Do()
+			getOp, err := getInstanceCall.Context(c.base.config.Context).Do()
 			if err != nil {
 				return err
 			}
 			for _, disk := range getOp.Disks {
 				// Set all attached compute disks to auto delete on instance deletion
 				diskSetCall := c.serviceClient.Instances.SetDiskAutoDelete(c.base.config.Project, zone, instanceID, true, disk.DeviceName)
-				// Todo - check this op until it completes, most likely not needed, but always nice to be safe
-				_, err := diskSetCall.Do()
+				diskOperation, err := diskSetCall.Context(c.base.config.Context).Do()
+				if err != nil {
+					return err
+				}
+				err = waitForOperation(c.base.config, fmt.Sprintf("auto delete of disk %v of %v [type: %v project: %v zone: %v]", disk.DeviceName, instanceID, c.Name(), c.base.config.Project, zone), computeOperation(c.serviceClient, c.base.config.Project, diskOperation))
 				if err != nil {
 					return err
 				}
 			}
 			deleteCall := c.serviceClient.Instances.Delete(c.base.config.Project, zone, instanceID)
-			operation, err := deleteCall.Do()
+			operation, err := deleteCall.Context(c.base.config.Context).Do()
 			if err != nil {
 				return err
 			}
-			var opStatus string
-			seconds := 0
-			for opStatus != "DONE" {
-				log.Printf("[Info] Resource currently being deleted %v [type: %v project: %v zone: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, zone, seconds)
-
-				operationCall := c.serviceClient.ZoneOperations.Get(c.base.config.Project, zone, operation.Name)
-				checkOpp, err := operationCall.Do()
-				if err != nil {
-					return err
-				}
-				opStatus = checkOpp.Status
-
-				time.Sleep(time.Duration(c.base.config.PollTime) * time.Second)
-				seconds += c.base.config.PollTime
-				if seconds > c.base.config.Timeout {
-					return fmt.Errorf("[Error] Resource deletion timed out for %v [type: %v project: %v zone: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, zone, c.base.config.Timeout)
-				}
+			err = waitForOperation(c.base.config, fmt.Sprintf("deletion of %v [type: %v project: %v zone: %v]", instanceID, c.Name(), c.base.config.Project, zone), computeOperation(c.serviceClient, c.base.config.Project, operation))
+			if err != nil {
+				return err
 			}
 			c.resourceMap.Delete(instanceID)
 
-			log.Printf("[Info] Resource deleted %v [type: %v project: %v zone: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, zone, seconds)
+			log.Printf("[Info] Resource deleted %v [type: %v project: %v zone: %v]", instanceID, c.Name(), c.base.config.Project, zone)
 			return nil
 		})
 
@@ -3,8 +3,6 @@ package resources
 import (
 	"fmt"
 	"log"
-	"sync"
-	"time"
 
 	"github.com/ianbrown78/gcp-nuke/config"
 	"github.com/ianbrown78/gcp-nuke/helpers"
@@ -21,14 +19,7 @@ type ComputeNetworkPeerings struct {
 }
 
 func init() {
-	computeService, err := compute.NewService(Ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	computeResource := ComputeNetworkPeerings{
-		serviceClient: computeService,
-	}
-	register(&computeResource)
+	register(func() Resource { return &ComputeNetworkPeerings{} })
 }
 
 // Name - Name of the resourceLister for ComputeNetworkPeerings
@@ -42,32 +33,57 @@ func (c *ComputeNetworkPeerings) ToSlice() (slice []string) {
 
 }
 
-// Setup - populates the struct
-func (c *ComputeNetworkPeerings) Setup(config config.Config) {
+// Filtered - Items of ComputeNetworkPeerings which were kept by a filter during the last listing
+func (c *ComputeNetworkPeerings) Filtered() map[string]string {
+	return c.base.filteredItems()
+}
+
+// Properties - Properties of the items of ComputeNetworkPeerings seen during the last listing, including filtered ones
+func (c *ComputeNetworkPeerings) Properties() map[string]DefaultResourceProperties {
+	return c.base.itemProperties()
+}
+
+// Setup - populates the struct and creates the API client
+func (c *ComputeNetworkPeerings) Setup(config config.Config) error {
 	c.base.config = config
 
+	computeService, err := compute.NewService(config.Context, clientOptions(config, "compute")...)
+	if err != nil {
+		return err
+	}
+	c.serviceClient = computeService
+	return nil
 }
 
 // List - Returns a list of all ComputeNetworkPeerings
-func (c *ComputeNetworkPeerings) List(refreshCache bool) []string {
+func (c *ComputeNetworkPeerings) List(refreshCache bool) ([]string, error) {
 	if !refreshCache {
-		return c.ToSlice()
+		return c.ToSlice(), nil
 	}
 	// Refresh resource map
-	c.resourceMap = sync.Map{}
-
-	networkListCall := c.serviceClient.Networks.List(c.base.config.Project)
-	networkList, err := networkListCall.Do()
+	helpers.ClearSyncMap(&c.resourceMap)
+	c.base.resetFiltered()
+
+	err := c.serviceClient.Networks.List(c.base.config.Project).Pages(c.base.config.Context, func(networkList *compute.NetworkList) error {
+		for _, network := range networkList.Items {
+			for _, networkPeering := range network.Peerings {
+				// Peerings carry no creation time, so they are always kept by age filters
+				if c.base.filtered(c.Name(), networkPeering.Name, DefaultResourceProperties{}) {
+					continue
+				}
+				c.resourceMap.Store(networkPeering.Name, network.Name)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		log.Fatal(err)
-	}
-
-	for _, network := range networkList.Items {
-		for _, networkPeering := range network.Peerings {
-			c.resourceMap.Store(networkPeering.Name, network.Name)
+		if classifyAPIError(err) == apiErrorDisabled {
+			log.Println("Compute Engine API not enabled. Skipping.")
+			return c.ToSlice(), nil
 		}
+		return nil, err
 	}
-	return c.ToSlice()
+	return c.ToSlice(), nil
 }
 
 // Dependencies - Returns a List of resource names to check for
@@ -78,6 +94,11 @@ func (c *ComputeNetworkPeerings) Dependencies() []string {
 	return []string{a.Name(), b.Name(), cl.Name()}
 }
 
+// Service - API service of the items of ComputeNetworkPeerings
+func (c *ComputeNetworkPeerings) Service() string {
+	return "compute.googleapis.com"
+}
+
 // Remove -
 func (c *ComputeNetworkPeerings) Remove() error {
 
@@ -94,31 +115,18 @@ func (c *ComputeNetworkPeerings) Remove() error {
 			deleteCall := c.serviceClient.Networks.RemovePeering(c.base.config.Project, networkID, &compute.NetworksRemovePeeringRequest{
 				Name: networkPeeringID,
 			})
-			operation, err := deleteCall.Do()
+			operation, err := deleteCall.Context(c.base.config.Context).Do()
 			if err != nil {
 				return err
 			}
-			var opStatus string
-			seconds := 0
-			for opStatus != "DONE" {
-				log.Printf("[Info] Resource currently being deleted %v [type: %v project: %v] (%v seconds)", networkID, c.Name(), c.base.config.Project, seconds)
-
-				operationCall := c.serviceClient.GlobalOperations.Get(c.base.config.Project, operation.Name)
-				checkOpp, err := operationCall.Do()
-				if err != nil {
-					return err
-				}
-				opStatus = checkOpp.Status
-
-				time.Sleep(time.Duration(c.base.config.PollTime) * time.Second)
-				seconds += c.base.config.PollTime
-				if seconds > c.base.config.Timeout {
-					return fmt.Errorf("[Error] Resource deletion timed out for %v [type: %v project: %v] (%v seconds)", networkID, c.Name(), c.base.config.Project, c.base.config.Timeout)
-				}
+			err = waitForOperation(c.base.config, fmt.Sprintf("deletion of %v of network %v [type: %v project: %v]", networkPeeringID, networkID, c.Name(), c.base.config.Project), computeOperation(c.serviceClient, c.base.config.Project, operation))
+			if err != nil {
+				return err
 			}
-			c.resourceMap.Delete(networkID)
+			// Items are keyed by peering name
+			c.resourceMap.Delete(networkPeeringID)
 
-			log.Printf("[Info] Resource deleted %v [type: %v project: %v] (%v seconds)", networkID, c.Name(), c.base.config.Project, seconds)
+			log.Printf("[Info] Resource deleted %v of network %v [type: %v project: %v]", networkPeeringID, networkID, c.Name(), c.base.config.Project)
 			return nil
 		})
 		return true
@@ -3,8 +3,6 @@ package resources
 import (
 	"fmt"
 	"log"
-	"sync"
-	"time"
 
 	"github.com/ianbrown78/gcp-nuke/config"
 	"github.com/ianbrown78/gcp-nuke/helpers"
@@ -21,14 +19,7 @@ type ComputeRegionAutoScalers struct {
 }
 
 func init() {
-	computeService, err := compute.NewService(Ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	computeResource := ComputeRegionAutoScalers{
-		serviceClient: computeService,
-	}
-	register(&computeResource)
+	register(func() Resource { return &ComputeRegionAutoScalers{} })
 }
 
 // Name - Name of the resourceLister for ComputeRegionAutoScalers
@@ -42,35 +33,64 @@ func (c *ComputeRegionAutoScalers) ToSlice() (slice []string) {
 
 }
 
-// Setup - populates the struct
-func (c *ComputeRegionAutoScalers) Setup(config config.Config) {
+// Filtered - Items of ComputeRegionAutoScalers which were kept by a filter during the last listing
+func (c *ComputeRegionAutoScalers) Filtered() map[string]string {
+	return c.base.filteredItems()
+}
+
+// Properties - Properties of the items of ComputeRegionAutoScalers seen during the last listing, including filtered ones
+func (c *ComputeRegionAutoScalers) Properties() map[string]DefaultResourceProperties {
+	return c.base.itemProperties()
+}
+
+// Setup - populates the struct and creates the API client
+func (c *ComputeRegionAutoScalers) Setup(config config.Config) error {
 	c.base.config = config
 
+	computeService, err := compute.NewService(config.Context, clientOptions(config, "compute")...)
+	if err != nil {
+		return err
+	}
+	c.serviceClient = computeService
+	return nil
 }
 
 // List - Returns a list of all ComputeRegionAutoScalers
-func (c *ComputeRegionAutoScalers) List(refreshCache bool) []string {
+func (c *ComputeRegionAutoScalers) List(refreshCache bool) ([]string, error) {
 	if !refreshCache {
-		return c.ToSlice()
+		return c.ToSlice(), nil
 	}
 	// Refresh resource map
-	c.resourceMap = sync.Map{}
-
-	for _, region := range c.base.config.Regions {
-		instanceListCall := c.serviceClient.RegionAutoscalers.List(c.base.config.Project, region)
-		instanceList, err := instanceListCall.Do()
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		for _, instance := range instanceList.Items {
-			instanceResource := DefaultResourceProperties{
-				region: region,
+	helpers.ClearSyncMap(&c.resourceMap)
+	c.base.resetFiltered()
+
+	err := c.serviceClient.Autoscalers.AggregatedList(c.base.config.Project).Pages(c.base.config.Context, func(aggregatedList *compute.AutoscalerAggregatedList) error {
+		for scope, scopedList := range aggregatedList.Items {
+			kind, region := aggregatedScope(scope)
+			if kind != "regions" || !locationSelected(c.base.config.Regions, region) {
+				continue
 			}
-			c.resourceMap.Store(instance.Name, instanceResource)
+			for _, instance := range scopedList.Autoscalers {
+				instanceResource := DefaultResourceProperties{
+					region:  region,
+					created: parseCreationTime(instance.CreationTimestamp),
+				}
+				if c.base.filtered(c.Name(), instance.Name, instanceResource) {
+					continue
+				}
+				c.resourceMap.Store(instance.Name, instanceResource)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if classifyAPIError(err) == apiErrorDisabled {
+			log.Println("Compute Engine API not enabled. Skipping.")
+			return c.ToSlice(), nil
 		}
+		return nil, err
 	}
-	return c.ToSlice()
+	return c.ToSlice(), nil
 }
 
 // Dependencies - Returns a List of resource names to check for
@@ -78,6 +98,11 @@ func (c *ComputeRegionAutoScalers) Dependencies() []string {
 	return []string{}
 }
 
+// Service - API service of the items of ComputeRegionAutoScalers
+func (c *ComputeRegionAutoScalers) Service() string {
+	return "compute.googleapis.com"
+}
+
 // Remove -
 func (c *ComputeRegionAutoScalers) Remove() error {
 
@@ -91,30 +116,17 @@ func (c *ComputeRegionAutoScalers) Remove() error {
 		// Parallel instance deletion
 		errs.Go(func() error {
 			deleteCall := c.serviceClient.RegionAutoscalers.Delete(c.base.config.Project, region, instanceID)
-			operation, err := deleteCall.Do()
+			operation, err := deleteCall.Context(c.base.config.Context).Do()
 			if err != nil {
 				return err
 			}
-			var opStatus string
-			seconds := 0
-			for opStatus != "DONE" {
-				log.Printf("[Info] Resource currently being deleted %v [type: %v project: %v region: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, region, seconds)
-				operationCall := c.serviceClient.RegionOperations.Get(c.base.config.Project, region, operation.Name)
-				checkOpp, err := operationCall.Do()
-				if err != nil {
-					return err
-				}
-				opStatus = checkOpp.Status
-
-				time.Sleep(time.Duration(c.base.config.PollTime) * time.Second)
-				seconds += c.base.config.PollTime
-				if seconds > c.base.config.Timeout {
-					return fmt.Errorf("[Error] Resource deletion timed out for %v [type: %v project: %v region: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, region, c.base.config.Timeout)
-				}
+			err = waitForOperation(c.base.config, fmt.Sprintf("deletion of %v [type: %v project: %v region: %v]", instanceID, c.Name(), c.base.config.Project, region), computeOperation(c.serviceClient, c.base.config.Project, operation))
+			if err != nil {
+				return err
 			}
 			c.resourceMap.Delete(instanceID)
 
-			log.Printf("[Info] Resource deleted %v [type: %v project: %v region: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, region, seconds)
+			log.Printf("[Info] Resource deleted %v [type: %v project: %v region: %v]", instanceID, c.Name(), c.base.config.Project, region)
 			return nil
 		})
 		return true
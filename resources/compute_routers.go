@@ -3,8 +3,6 @@ package resources
 import (
 	"fmt"
 	"log"
-	"sync"
-	"time"
 
 	"github.com/ianbrown78/gcp-nuke/config"
 	"github.com/ianbrown78/gcp-nuke/helpers"
@@ -21,14 +19,7 @@ type ComputeRouters struct {
 }
 
 func init() {
-	computeService, err := compute.NewService(Ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	computeResource := ComputeRouters{
-		serviceClient: computeService,
-	}
-	register(&computeResource)
+	register(func() Resource { return &ComputeRouters{} })
 }
 
 // Name - Name of the resourceLister for ComputeRouters
@@ -42,32 +33,64 @@ func (c *ComputeRouters) ToSlice() (slice []string) {
 
 }
 
-// Setup - populates the struct
-func (c *ComputeRouters) Setup(config config.Config) {
+// Filtered - Items of ComputeRouters which were kept by a filter during the last listing
+func (c *ComputeRouters) Filtered() map[string]string {
+	return c.base.filteredItems()
+}
+
+// Properties - Properties of the items of ComputeRouters seen during the last listing, including filtered ones
+func (c *ComputeRouters) Properties() map[string]DefaultResourceProperties {
+	return c.base.itemProperties()
+}
+
+// Setup - populates the struct and creates the API client
+func (c *ComputeRouters) Setup(config config.Config) error {
 	c.base.config = config
 
+	computeService, err := compute.NewService(config.Context, clientOptions(config, "compute")...)
+	if err != nil {
+		return err
+	}
+	c.serviceClient = computeService
+	return nil
 }
 
 // List - Returns a list of all ComputeRouters
-func (c *ComputeRouters) List(refreshCache bool) []string {
+func (c *ComputeRouters) List(refreshCache bool) ([]string, error) {
 	if !refreshCache {
-		return c.ToSlice()
+		return c.ToSlice(), nil
 	}
 	// Refresh resource map
-	c.resourceMap = sync.Map{}
-
-	for _, region := range c.base.config.Regions {
-		routerListCall := c.serviceClient.Routers.List(c.base.config.Project, region)
-		routerList, err := routerListCall.Do()
-		if err != nil {
-			log.Fatal(err)
+	helpers.ClearSyncMap(&c.resourceMap)
+	c.base.resetFiltered()
+
+	err := c.serviceClient.Routers.AggregatedList(c.base.config.Project).Pages(c.base.config.Context, func(aggregatedList *compute.RouterAggregatedList) error {
+		for scope, scopedList := range aggregatedList.Items {
+			kind, region := aggregatedScope(scope)
+			if kind != "regions" || !locationSelected(c.base.config.Regions, region) {
+				continue
+			}
+			for _, router := range scopedList.Routers {
+				instanceResource := DefaultResourceProperties{
+					region:  region,
+					created: parseCreationTime(router.CreationTimestamp),
+				}
+				if c.base.filtered(c.Name(), router.Name, instanceResource) {
+					continue
+				}
+				c.resourceMap.Store(router.Name, instanceResource)
+			}
 		}
-
-		for _, router := range routerList.Items {
-			c.resourceMap.Store(router.Name, region)
+		return nil
+	})
+	if err != nil {
+		if classifyAPIError(err) == apiErrorDisabled {
+			log.Println("Compute Engine API not enabled. Skipping.")
+			return c.ToSlice(), nil
 		}
+		return nil, err
 	}
-	return c.ToSlice()
+	return c.ToSlice(), nil
 }
 
 // Dependencies - Returns a List of resource names to check for
@@ -77,6 +100,11 @@ func (c *ComputeRouters) Dependencies() []string {
 	return []string{a.Name(), b.Name()}
 }
 
+// Service - API service of the items of ComputeRouters
+func (c *ComputeRouters) Service() string {
+	return "compute.googleapis.com"
+}
+
 // Remove -
 func (c *ComputeRouters) Remove() error {
 
@@ -85,36 +113,22 @@ func (c *ComputeRouters) Remove() error {
 
 	c.resourceMap.Range(func(key, value interface{}) bool {
 		routerID := key.(string)
-		region := value.(string)
+		region := value.(DefaultResourceProperties).region
 
 		// Parallel router deletion
 		errs.Go(func() error {
 			deleteCall := c.serviceClient.Routers.Delete(c.base.config.Project, region, routerID)
-			operation, err := deleteCall.Do()
+			operation, err := deleteCall.Context(c.base.config.Context).Do()
 			if err != nil {
 				return err
 			}
-			var opStatus string
-			seconds := 0
-			for opStatus != "DONE" {
-				log.Printf("[Info] Resource currently being deleted %v [type: %v project: %v] (%v seconds)", routerID, c.Name(), c.base.config.Project, seconds)
-
-				operationCall := c.serviceClient.RegionOperations.Get(c.base.config.Project, region, operation.Name)
-				checkOpp, err := operationCall.Do()
-				if err != nil {
-					return err
-				}
-				opStatus = checkOpp.Status
-
-				time.Sleep(time.Duration(c.base.config.PollTime) * time.Second)
-				seconds += c.base.config.PollTime
-				if seconds > c.base.config.Timeout {
-					return fmt.Errorf("[Error] Resource deletion timed out for %v [type: %v project: %v] (%v seconds)", routerID, c.Name(), c.base.config.Project, c.base.config.Timeout)
-				}
+			err = waitForOperation(c.base.config, fmt.Sprintf("deletion of %v [type: %v project: %v]", routerID, c.Name(), c.base.config.Project), computeOperation(c.serviceClient, c.base.config.Project, operation))
+			if err != nil {
+				return err
 			}
 			c.resourceMap.Delete(routerID)
 
-			log.Printf("[Info] Resource deleted %v [type: %v project: %v] (%v seconds)", routerID, c.Name(), c.base.config.Project, seconds)
+			log.Printf("[Info] Resource deleted %v [type: %v project: %v]", routerID, c.Name(), c.base.config.Project)
 			return nil
 		})
 		return true
@@ -3,8 +3,6 @@ package resources
 import (
 	"fmt"
 	"log"
-	"sync"
-	"time"
 
 	"github.com/ianbrown78/gcp-nuke/config"
 	"github.com/ianbrown78/gcp-nuke/helpers"
@@ -21,14 +19,7 @@ type ComputeVPNTunnels struct {
 }
 
 func init() {
-	computeService, err := compute.NewService(Ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	computeResource := ComputeVPNTunnels{
-		serviceClient: computeService,
-	}
-	register(&computeResource)
+	register(func() Resource { return &ComputeVPNTunnels{} })
 }
 
 // Name - Name of the resourceLister for ComputeVPNTunnels
@@ -42,32 +33,64 @@ func (c *ComputeVPNTunnels) ToSlice() (slice []string) {
 
 }
 
-// Setup - populates the struct
-func (c *ComputeVPNTunnels) Setup(config config.Config) {
+// Filtered - Items of ComputeVPNTunnels which were kept by a filter during the last listing
+func (c *ComputeVPNTunnels) Filtered() map[string]string {
+	return c.base.filteredItems()
+}
+
+// Properties - Properties of the items of ComputeVPNTunnels seen during the last listing, including filtered ones
+func (c *ComputeVPNTunnels) Properties() map[string]DefaultResourceProperties {
+	return c.base.itemProperties()
+}
+
+// Setup - populates the struct and creates the API client
+func (c *ComputeVPNTunnels) Setup(config config.Config) error {
 	c.base.config = config
 
+	computeService, err := compute.NewService(config.Context, clientOptions(config, "compute")...)
+	if err != nil {
+		return err
+	}
+	c.serviceClient = computeService
+	return nil
 }
 
 // List - Returns a list of all ComputeVPNTunnels
-func (c *ComputeVPNTunnels) List(refreshCache bool) []string {
+func (c *ComputeVPNTunnels) List(refreshCache bool) ([]string, error) {
 	if !refreshCache {
-		return c.ToSlice()
+		return c.ToSlice(), nil
 	}
 	// Refresh resource map
-	c.resourceMap = sync.Map{}
-
-	for _, region := range c.base.config.Regions {
-		tunnelListCall := c.serviceClient.VpnTunnels.List(c.base.config.Project, region)
-		tunnelList, err := tunnelListCall.Do()
-		if err != nil {
-			log.Fatal(err)
+	helpers.ClearSyncMap(&c.resourceMap)
+	c.base.resetFiltered()
+
+	err := c.serviceClient.VpnTunnels.AggregatedList(c.base.config.Project).Pages(c.base.config.Context, func(aggregatedList *compute.VpnTunnelAggregatedList) error {
+		for scope, scopedList := range aggregatedList.Items {
+			kind, region := aggregatedScope(scope)
+			if kind != "regions" || !locationSelected(c.base.config.Regions, region) {
+				continue
+			}
+			for _, tunnel := range scopedList.VpnTunnels {
+				instanceResource := DefaultResourceProperties{
+					region:  region,
+					created: parseCreationTime(tunnel.CreationTimestamp),
+				}
+				if c.base.filtered(c.Name(), tunnel.Name, instanceResource) {
+					continue
+				}
+				c.resourceMap.Store(tunnel.Name, instanceResource)
+			}
 		}
-
-		for _, tunnel := range tunnelList.Items {
-			c.resourceMap.Store(tunnel.Name, region)
+		return nil
+	})
+	if err != nil {
+		if classifyAPIError(err) == apiErrorDisabled {
+			log.Println("Compute Engine API not enabled. Skipping.")
+			return c.ToSlice(), nil
 		}
+		return nil, err
 	}
-	return c.ToSlice()
+	return c.ToSlice(), nil
 }
 
 // Dependencies - Returns a List of resource names to check for
@@ -75,6 +98,11 @@ func (c *ComputeVPNTunnels) Dependencies() []string {
 	return []string{}
 }
 
+// Service - API service of the items of ComputeVPNTunnels
+func (c *ComputeVPNTunnels) Service() string {
+	return "compute.googleapis.com"
+}
+
 // Remove -
 func (c *ComputeVPNTunnels) Remove() error {
 
@@ -83,36 +111,22 @@ func (c *ComputeVPNTunnels) Remove() error {
 
 	c.resourceMap.Range(func(key, value interface{}) bool {
 		tunnelID := key.(string)
-		region := value.(string)
+		region := value.(DefaultResourceProperties).region
 
 		// Parallel tunnel deletion
 		errs.Go(func() error {
 			deleteCall := c.serviceClient.VpnTunnels.Delete(c.base.config.Project, region, tunnelID)
-			operation, err := deleteCall.Do()
+			operation, err := deleteCall.Context(c.base.config.Context).Do()
 			if err != nil {
 				return err
 			}
-			var opStatus string
-			seconds := 0
-			for opStatus != "DONE" {
-				log.Printf("[Info] Resource currently being deleted %v [type: %v project: %v] (%v seconds)", tunnelID, c.Name(), c.base.config.Project, seconds)
-
-				operationCall := c.serviceClient.RegionOperations.Get(c.base.config.Project, region, operation.Name)
-				checkOpp, err := operationCall.Do()
-				if err != nil {
-					return err
-				}
-				opStatus = checkOpp.Status
-
-				time.Sleep(time.Duration(c.base.config.PollTime) * time.Second)
-				seconds += c.base.config.PollTime
-				if seconds > c.base.config.Timeout {
-					return fmt.Errorf("[Error] Resource deletion timed out for %v [type: %v project: %v] (%v seconds)", tunnelID, c.Name(), c.base.config.Project, c.base.config.Timeout)
-				}
+			err = waitForOperation(c.base.config, fmt.Sprintf("deletion of %v [type: %v project: %v]", tunnelID, c.Name(), c.base.config.Project), computeOperation(c.serviceClient, c.base.config.Project, operation))
+			if err != nil {
+				return err
 			}
 			c.resourceMap.Delete(tunnelID)
 
-			log.Printf("[Info] Resource deleted %v [type: %v project: %v] (%v seconds)", tunnelID, c.Name(), c.base.config.Project, seconds)
+			log.Printf("[Info] Resource deleted %v [type: %v project: %v]", tunnelID, c.Name(), c.base.config.Project)
 			return nil
 		})
 		return true
@@ -3,8 +3,6 @@ package resources
 import (
 	"fmt"
 	"log"
-	"sync"
-	"time"
 
 	"github.com/ianbrown78/gcp-nuke/config"
 	"github.com/ianbrown78/gcp-nuke/helpers"
@@ -21,14 +19,7 @@ type ComputeZoneAutoScalers struct {
 }
 
 func init() {
-	computeService, err := compute.NewService(Ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	computeResource := ComputeZoneAutoScalers{
-		serviceClient: computeService,
-	}
-	register(&computeResource)
+	register(func() Resource { return &ComputeZoneAutoScalers{} })
 }
 
 // Name - Name of the resourceLister for ComputeZoneAutoScalers
@@ -42,35 +33,64 @@ func (c *ComputeZoneAutoScalers) ToSlice() (slice []string) {
 
 }
 
-// Setup - populates the struct
-func (c *ComputeZoneAutoScalers) Setup(config config.Config) {
+// Filtered - Items of ComputeZoneAutoScalers which were kept by a filter during the last listing
+func (c *ComputeZoneAutoScalers) Filtered() map[string]string {
+	return c.base.filteredItems()
+}
+
+// Properties - Properties of the items of ComputeZoneAutoScalers seen during the last listing, including filtered ones
+func (c *ComputeZoneAutoScalers) Properties() map[string]DefaultResourceProperties {
+	return c.base.itemProperties()
+}
+
+// Setup - populates the struct and creates the API client
+func (c *ComputeZoneAutoScalers) Setup(config config.Config) error {
 	c.base.config = config
 
+	computeService, err := compute.NewService(config.Context, clientOptions(config, "compute")...)
+	if err != nil {
+		return err
+	}
+	c.serviceClient = computeService
+	return nil
 }
 
 // List - Returns a list of all ComputeZoneAutoScalers
-func (c *ComputeZoneAutoScalers) List(refreshCache bool) []string {
+func (c *ComputeZoneAutoScalers) List(refreshCache bool) ([]string, error) {
 	if !refreshCache {
-		return c.ToSlice()
+		return c.ToSlice(), nil
 	}
 	// Refresh resource map
-	c.resourceMap = sync.Map{}
-
-	for _, zone := range c.base.config.Zones {
-		instanceListCall := c.serviceClient.Autoscalers.List(c.base.config.Project, zone)
-		instanceList, err := instanceListCall.Do()
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		for _, instance := range instanceList.Items {
-			instanceResource := DefaultResourceProperties{
-				zone: zone,
+	helpers.ClearSyncMap(&c.resourceMap)
+	c.base.resetFiltered()
+
+	err := c.serviceClient.Autoscalers.AggregatedList(c.base.config.Project).Pages(c.base.config.Context, func(aggregatedList *compute.AutoscalerAggregatedList) error {
+		for scope, scopedList := range aggregatedList.Items {
+			kind, zone := aggregatedScope(scope)
+			if kind != "zones" || !locationSelected(c.base.config.Zones, zone) {
+				continue
 			}
-			c.resourceMap.Store(instance.Name, instanceResource)
+			for _, instance := range scopedList.Autoscalers {
+				instanceResource := DefaultResourceProperties{
+					zone:    zone,
+					created: parseCreationTime(instance.CreationTimestamp),
+				}
+				if c.base.filtered(c.Name(), instance.Name, instanceResource) {
+					continue
+				}
+				c.resourceMap.Store(instance.Name, instanceResource)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if classifyAPIError(err) == apiErrorDisabled {
+			log.Println("Compute Engine API not enabled. Skipping.")
+			return c.ToSlice(), nil
 		}
+		return nil, err
 	}
-	return c.ToSlice()
+	return c.ToSlice(), nil
 }
 
 // Dependencies - Returns a List of resource names to check for
@@ -78,6 +98,11 @@ func (c *ComputeZoneAutoScalers) Dependencies() []string {
 	return []string{}
 }
 
+// Service - API service of the items of ComputeZoneAutoScalers
+func (c *ComputeZoneAutoScalers) Service() string {
+	return "compute.googleapis.com"
+}
+
 // Remove -
 func (c *ComputeZoneAutoScalers) Remove() error {
 
@@ -91,31 +116,17 @@ func (c *ComputeZoneAutoScalers) Remove() error {
 		// Parallel instance deletion
 		errs.Go(func() error {
 			deleteCall := c.serviceClient.Autoscalers.Delete(c.base.config.Project, zone, instanceID)
-			operation, err := deleteCall.Do()
+			operation, err := deleteCall.Context(c.base.config.Context).Do()
 			if err != nil {
 				return err
 			}
-			var opStatus string
-			seconds := 0
-			for opStatus != "DONE" {
-				log.Printf("[Info] Resource currently being deleted %v [type: %v project: %v zone: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, zone, seconds)
-
-				operationCall := c.serviceClient.ZoneOperations.Get(c.base.config.Project, zone, operation.Name)
-				checkOpp, err := operationCall.Do()
-				if err != nil {
-					return err
-				}
-				opStatus = checkOpp.Status
-
-				time.Sleep(time.Duration(c.base.config.PollTime) * time.Second)
-				seconds += c.base.config.PollTime
-				if seconds > c.base.config.Timeout {
-					return fmt.Errorf("[Error] Resource deletion timed out for %v [type: %v project: %v zone: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, zone, c.base.config.Timeout)
-				}
+			err = waitForOperation(c.base.config, fmt.Sprintf("deletion of %v [type: %v project: %v zone: %v]", instanceID, c.Name(), c.base.config.Project, zone), computeOperation(c.serviceClient, c.base.config.Project, operation))
+			if err != nil {
+				return err
 			}
 			c.resourceMap.Delete(instanceID)
 
-			log.Printf("[Info] Resource deleted %v [type: %v project: %v zone: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, zone, seconds)
+			log.Printf("[Info] Resource deleted %v [type: %v project: %v zone: %v]", instanceID, c.Name(), c.base.config.Project, zone)
 			return nil
 		})
 		return true
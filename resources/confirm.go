@@ -0,0 +1,42 @@
+package resources
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/ianbrown78/gcp-nuke/config"
+	"github.com/ianbrown78/gcp-nuke/helpers"
+)
+
+// confirmMutex - projects nuked in parallel ask one at a time, countdowns of --force run at the same time
+var confirmMutex sync.Mutex
+
+// confirmNuke - asks the user to retype the project id, or counts down when running with --force
+func confirmNuke(config config.Config, question string) error {
+	if config.Force {
+		helpers.Countdown(fmt.Sprintf("Running with --force, project %v will be nuked", config.Project), config.ForceSleep)
+		return nil
+	}
+	if !helpers.IsTerminal() {
+		return fmt.Errorf("[Error] stdin is not a terminal, use --force to nuke project %v non-interactively", config.Project)
+	}
+	confirmMutex.Lock()
+	defer confirmMutex.Unlock()
+	return helpers.Prompt(question, config.Project)
+}
+
+// printInventory - logs every resource which would be removed, in a stable order
+func printInventory(resourceMap map[string]Resource, config config.Config) {
+	names := []string{}
+	for name := range resourceMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	log.Printf("[Info] Inventory of project %v:", config.Project)
+	for _, name := range names {
+		parallelDryRun(resourceMap, resourceMap[name], config)
+	}
+}
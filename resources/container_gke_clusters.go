@@ -1,11 +1,10 @@
 package resources
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strings"
-	"sync"
-	"time"
 
 	"github.com/ianbrown78/gcp-nuke/config"
 	"github.com/ianbrown78/gcp-nuke/helpers"
@@ -16,21 +15,13 @@ import (
 
 // ContainerGKEClusters -
 type ContainerGKEClusters struct {
-	serviceClient  *container.Service
-	base           ResourceBase
-	resourceMap    syncmap.Map
-	InstanceGroups []string
+	serviceClient *container.Service
+	base          ResourceBase
+	resourceMap   syncmap.Map
 }
 
 func init() {
-	containerService, err := container.NewService(Ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	containerResource := ContainerGKEClusters{
-		serviceClient: containerService,
-	}
-	register(&containerResource)
+	register(func() Resource { return &ContainerGKEClusters{} })
 }
 
 // Name - Name of the resourceLister for ContainerGKEClusters
@@ -44,41 +35,73 @@ func (c *ContainerGKEClusters) ToSlice() (slice []string) {
 
 }
 
-// Setup - populates the struct
-func (c *ContainerGKEClusters) Setup(config config.Config) {
+// Filtered - Items of ContainerGKEClusters which were kept by a filter during the last listing
+func (c *ContainerGKEClusters) Filtered() map[string]string {
+	return c.base.filteredItems()
+}
+
+// Properties - Properties of the items of ContainerGKEClusters seen during the last listing, including filtered ones
+func (c *ContainerGKEClusters) Properties() map[string]DefaultResourceProperties {
+	return c.base.itemProperties()
+}
+
+// Setup - populates the struct and creates the API client
+func (c *ContainerGKEClusters) Setup(config config.Config) error {
 	c.base.config = config
 
+	containerService, err := container.NewService(config.Context, clientOptions(config, "container")...)
+	if err != nil {
+		return err
+	}
+	c.serviceClient = containerService
+	return nil
 }
 
 // List - Returns a list of all ContainerGKEClusters
-func (c *ContainerGKEClusters) List(refreshCache bool) []string {
+func (c *ContainerGKEClusters) List(refreshCache bool) ([]string, error) {
 	if !refreshCache {
-		return c.ToSlice()
+		return c.ToSlice(), nil
 	}
 	// Refresh resource map
-	c.resourceMap = sync.Map{}
+	helpers.ClearSyncMap(&c.resourceMap)
+	c.base.resetFiltered()
 
+	// Clusters.List is not paginated, all clusters are returned at once
 	instanceListCall := c.serviceClient.Projects.Locations.Clusters.List(fmt.Sprintf("projects/%v/locations/-", c.base.config.Project))
-	instanceList, err := instanceListCall.Do()
+	instanceList, err := instanceListCall.Context(c.base.config.Context).Do()
 	if err != nil {
 		// check if the API is enabled/
-		if !strings.Contains(err.Error(), "API has not been used in project") {
-			// Otherwise, throw an error.
-			log.Fatal(err)
+		if classifyAPIError(err) != apiErrorDisabled {
+			// Otherwise, return the error.
+			return nil, err
 		} else {
 			log.Println("GKE API not enabled. Skipping.")
-			return c.ToSlice()
+			return c.ToSlice(), nil
 		}
 	}
 
 	for _, instance := range instanceList.Clusters {
-		c.appendInstanceGroups(instance.Name, instance.Location)
-		instanceResource := DefaultResourceProperties{}
+		if !itemLocationSelected(c.base.config, instance.Location) {
+			continue
+		}
 		clusterLink := extractGKESelfLink(instance.SelfLink)
+		instanceResource := DefaultResourceProperties{
+			// Zone or region of the cluster
+			region:  instance.Location,
+			labels:  instance.ResourceLabels,
+			created: parseCreationTime(instance.CreateTime),
+		}
+		// Boot disks of the current nodes, assuming every node pool uses the disk size of the default one
+		if instance.NodeConfig != nil {
+			instanceResource.sizeBytes = instance.CurrentNodeCount * instance.NodeConfig.DiskSizeGb * gibibyte
+		}
+		if c.base.filtered(c.Name(), clusterLink, instanceResource) {
+			continue
+		}
 		c.resourceMap.Store(clusterLink, instanceResource)
 	}
 
-	return c.ToSlice()
+	return c.ToSlice(), nil
 }
 
 // Dependencies - Returns a List of resource names to check for
@@ -86,6 +109,11 @@ func (c *ContainerGKEClusters) Dependencies() []string {
 	return []string{}
 }
 
+// Service - API service of the items of ContainerGKEClusters
+func (c *ContainerGKEClusters) Service() string {
+	return "container.googleapis.com"
+}
+
 // Remove -
 func (c *ContainerGKEClusters) Remove() error {
 
@@ -98,30 +126,17 @@ func (c *ContainerGKEClusters) Remove() error {
 		// Parallel instance deletion
 		errs.Go(func() error {
 			deleteCall := c.serviceClient.Projects.Locations.Clusters.Delete(instanceID)
-			operation, err := deleteCall.Do()
+			operation, err := deleteCall.Context(c.base.config.Context).Do()
 			if err != nil {
 				return err
 			}
-			var opStatus string
-			seconds := 0
-			for opStatus != "DONE" {
-				log.Printf("[Info] Resource currently being deleted %v [type: %v project: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, seconds)
-				operationCall := c.serviceClient.Projects.Locations.Operations.Get(fmt.Sprintf("projects/%v/locations/%v/operations/%v", c.base.config.Project, location, operation.Name))
-				checkOpp, err := operationCall.Do()
-				if err != nil {
-					return err
-				}
-				opStatus = checkOpp.Status
-
-				time.Sleep(time.Duration(c.base.config.PollTime) * time.Second)
-				seconds += c.base.config.PollTime
-				if seconds > c.base.config.Timeout {
-					return fmt.Errorf("[Error] Resource deletion timed out for %v [type: %v project: %v] (%v seconds):\n %v", instanceID, c.Name(), c.base.config.Project, c.base.config.Timeout, err.Error())
-				}
+			err = waitForOperation(c.base.config, fmt.Sprintf("deletion of %v [type: %v project: %v location: %v]", instanceID, c.Name(), c.base.config.Project, location), containerOperation(c.serviceClient, operation))
+			if err != nil {
+				return err
 			}
 			c.resourceMap.Delete(instanceID)
 
-			log.Printf("[Info] Resource deleted %v [type: %v project: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, seconds)
+			log.Printf("[Info] Resource deleted %v [type: %v project: %v location: %v]", instanceID, c.Name(), c.base.config.Project, location)
 			return nil
 		})
 		return true
@@ -131,18 +146,26 @@ func (c *ContainerGKEClusters) Remove() error {
 	return err
 }
 
-// appendInstanceGroups - keep track of instance groups - this is used by compute_instance_zone_groups to exclude any gke nodepools
-func (c *ContainerGKEClusters) appendInstanceGroups(clusterName, clusterLocation string) {
-	parentLocation := fmt.Sprintf("projects/%v/locations/%v/clusters/%v", c.base.config.Project, clusterLocation, clusterName)
-	nodePoolCall := c.serviceClient.Projects.Locations.Clusters.NodePools.List(parentLocation)
-	nodePools, err := nodePoolCall.Do()
+// gkeNodePoolInstanceGroups - names of the instance groups backing GKE node pools - this is used by compute_instance_zone_groups to exclude them
+func gkeNodePoolInstanceGroups(ctx context.Context, serviceClient *container.Service, project string) ([]string, error) {
+	clusterListCall := serviceClient.Projects.Locations.Clusters.List(fmt.Sprintf("projects/%v/locations/-", project))
+	clusterList, err := clusterListCall.Context(ctx).Do()
 	if err != nil {
-		log.Fatal((err))
+		if classifyAPIError(err) == apiErrorDisabled {
+			return []string{}, nil
+		}
+		return nil, err
 	}
-	for _, nodePool := range nodePools.NodePools {
-		for _, instanceGroupURL := range nodePool.InstanceGroupUrls {
-			instanceGroupName := strings.Split(instanceGroupURL, "/instanceGroupManagers/")[1]
-			c.InstanceGroups = append(c.InstanceGroups, instanceGroupName)
+
+	instanceGroups := []string{}
+	// Clusters are listed with their node pools, filtered clusters included as their node pools have to survive too
+	for _, cluster := range clusterList.Clusters {
+		for _, nodePool := range cluster.NodePools {
+			for _, instanceGroupURL := range nodePool.InstanceGroupUrls {
+				instanceGroupName := strings.Split(instanceGroupURL, "/instanceGroupManagers/")[1]
+				instanceGroups = append(instanceGroups, instanceGroupName)
+			}
 		}
 	}
+	return instanceGroups, nil
 }
@@ -1,174 +1,286 @@
 package resources
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ianbrown78/gcp-nuke/config"
 	"github.com/ianbrown78/gcp-nuke/helpers"
-	"golang.org/x/sync/errgroup"
-	"google.golang.org/api/cloudresourcemanager/v3"
 )
 
-// RemoveProjectResources  -
-func RemoveProjectResources(config config.Config) {
-	helpers.SetupCloseHandler()
-	resourceMap := GetResourceMap(config)
+// RemoveProjectResources  - removes all selected resources, errors of each resource type are collected and returned together
+func RemoveProjectResources(projectConfig config.Config) error {
+	return RemoveProjects([]config.Config{projectConfig}, 1)
+}
 
-	// Parallel deletion
-	errs, _ := errgroup.WithContext(config.Context)
+// RemoveProjects - nukes every project with its own resource instances, at most maxParallel projects at a time.
+// A failing project does not stop the others, a summary of every project is logged at the end.
+func RemoveProjects(configs []config.Config, maxParallel int) error {
+	if maxParallel < 1 {
+		maxParallel = 1
+	}
+	// Cancelled on the first interrupt, no projects or deletions are started after it
+	stopped, stop := context.WithCancel(context.Background())
+	defer stop()
+	running := newRunningProjects()
+	stopHandler := helpers.SetupCloseHandler(stop, running.terminate)
+	defer stopHandler()
 
-	for _, resource := range resourceMap {
-		resource := resource
-		errs.Go(func() error {
-			log.Println("[Info] Retrieving list of resources for", resource.Name())
-			resource.List(true)
-			if config.NoDryRun {
-				err := parallelResourceDeletion(resourceMap, resource, config)
-
-				if err != nil {
-					return err
-				}
-				return nil
+	results := make([]projectResult, len(configs))
+	slots := make(chan struct{}, maxParallel)
+	var wg sync.WaitGroup
+	for i, projectConfig := range configs {
+		i, projectConfig := i, projectConfig
+		// Projects which had not started when a run of several died have no checkpoint yet, so they start afresh
+		if len(configs) > 1 && projectConfig.Resume {
+			if _, err := os.Stat(projectConfig.CheckpointFile); errors.Is(err, os.ErrNotExist) {
+				log.Printf("[Info] No checkpoint %v for project %v, it had not started and is nuked from the beginning", projectConfig.CheckpointFile, projectConfig.Project)
+				projectConfig.Resume = false
 			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
 
-			parallelDryRun(resourceMap, resource, config)
+			results[i] = projectResult{project: projectConfig.Project, report: newRunReport(projectConfig)}
+			if stopped.Err() != nil {
+				results[i].err = fmt.Errorf("[Error] Interrupted before project %v was started", projectConfig.Project)
+				return
+			}
+			results[i].err = removeProject(projectConfig, stopped, running, results[i].report)
+		}()
+	}
+	wg.Wait()
 
-			if config.NoKeepProject {
-				err := deleteProject(config)
+	return reportProjects(results)
+}
 
-				if err != nil {
-					return err
-				}
-			}
+// removeProject - removes all selected resources of one project. Stops starting deletions once runStopped is cancelled.
+func removeProject(config config.Config, runStopped context.Context, running *runningProjects, report *runReport) error {
+	// Cancelled on a second interrupt, aborting every API call and operation wait
+	ctx, cancel := context.WithCancel(config.Context)
+	defer cancel()
+	config.Context = ctx
 
-			return nil
-		})
+	// Checkpoint of the run, continuing the one of an earlier run when resuming
+	var runCheckpoint *checkpoint
+	if config.CheckpointFile != "" {
+		var err error
+		if config.Resume {
+			runCheckpoint, err = loadCheckpoint(config.CheckpointFile, config.Project)
+		} else {
+			runCheckpoint = newCheckpoint(config.CheckpointFile, config.Project)
+		}
+		if err != nil {
+			return err
+		}
+		config.Context = withCheckpoint(config.Context, runCheckpoint)
 	}
+	// Cancelled on the first interrupt, no deletions are started after it
+	stopped, stop := context.WithCancel(config.Context)
+	defer stop()
+	go func() {
+		select {
+		case <-runStopped.Done():
+			stop()
+		case <-stopped.Done():
+		}
+	}()
 
-	// Wait for all deletions to complete, and check for errors
-	if err := errs.Wait(); err != nil {
-		log.Fatal(err)
+	resourceMap, err := GetResourceMap(config)
+	if err != nil {
+		return err
 	}
+	runErrs := newRunErrors(config.Project)
+	progress := newDeletionProgress(resourceMap)
+	running.add(config.Project, progress, cancel)
+	defer running.remove(config.Project)
 
-	log.Printf("-- Deletion complete for project %v (dry-run: %v) (keep-project: %v) --\n", config.Project, config.NoDryRun, config.NoKeepProject)
-}
-
-func parallelResourceDeletion(resourceMap map[string]Resource, resource Resource, config config.Config) error {
-	refreshCache := false
-	if len(resource.List(false)) == 0 {
-		log.Println("[Skipping] No", resource.Name(), "items to delete")
-		return nil
+	// First confirmation, before anything is listed
+	if config.NoDryRun && !config.Force {
+		err := confirmNuke(config, fmt.Sprintf("[Confirm] Do you really want to nuke project %v?", config.Project))
+		if err != nil {
+			return err
+		}
 	}
 
-	timeOut := config.Timeout
-	pollTime := config.PollTime
-	seconds := 0
+	// Operations of the interrupted run have to finish first, their items would be listed but cannot be deleted again
+	if config.Resume {
+		resumeOperations(config, runCheckpoint)
+	}
 
-	// Wait for dependencies to delete
-	for _, dependencyResourceName := range resource.Dependencies() {
-		if seconds > timeOut {
-			return fmt.Errorf("[Error] Resource %v timed out whilst waiting for dependency %v to delete. (%v seconds)", resource.Name(), dependencyResourceName, timeOut)
-		}
-		dependencyResource := resourceMap[dependencyResourceName]
-		for len(dependencyResource.List(false)) != 0 {
-			refreshCache = true
-			time.Sleep(time.Duration(pollTime) * time.Second)
-			seconds += pollTime
-			log.Printf("[Waiting] Resource %v waiting for dependency %v to delete. (%v seconds)\n", resource.Name(), dependencyResource.Name(), seconds)
+	listResources(resourceMap, runErrs)
+	printInventory(resourceMap, config)
+	if config.Plan != nil {
+		checkPlan(resourceMap, config)
+	}
+	listFailed := func(name string) bool {
+		return runErrs.failed(name, "list")
+	}
+	report.recordInventory(resourceMap, !config.NoDryRun, listFailed)
+	// Items still pending on any return were not deleted
+	defer report.close()
+	if runCheckpoint != nil {
+		runCheckpoint.recordInventory(resourceMap, listFailed)
+	}
+	// Records the outcome of the deletion of a resource type
+	finishType := func(name string, err error) {
+		report.finishType(name, resourceMap[name].ToSlice(), err)
+		if runCheckpoint != nil {
+			runCheckpoint.finishType(name, resourceMap[name].ToSlice(), err)
 		}
 	}
 
-	if refreshCache {
-		resource.List(refreshCache)
+	// Second confirmation, after the full inventory has been shown
+	if config.NoDryRun {
+		err := confirmNuke(config, fmt.Sprintf("[Confirm] The resources above will be deleted. Do you really want to nuke project %v?", config.Project))
+		if err != nil {
+			return err
+		}
 	}
 
-	log.Println("[Remove] Removing", resource.Name(), "items:", resource.List(false))
-	seconds = 0
-	err := resource.Remove()
-
-	// Unfortunately the API seems inconsistent with timings, so retry until any dependent resources delete
-	for apiErrorCheck(err) {
-		resource.List(true)
+	if stopped.Err() != nil {
+		return fmt.Errorf("[Error] Interrupted before deleting anything in project %v", config.Project)
+	}
 
-		if seconds > timeOut {
-			return fmt.Errorf("[Error] Resource %v timed out whilst trying to delete. (%v seconds). Details of error below:\n %v", resource.Name(), timeOut, err.Error())
+	// Deletion in dependency order, dry runs have nothing to delete
+	if config.NoDryRun {
+		progress.snapshot()
+		graph, err := newDependencyGraph(resourceMap)
+		if err != nil {
+			return err
+		}
+		for i, wave := range graph.waves() {
+			log.Printf("[Info] Deletion wave %v: %v", i+1, strings.Join(wave, ", "))
 		}
 
-		log.Printf("[Remove] In use Resource: %v. Items: %v. Waiting before retrying delete. (%v seconds)", resource.Name(), resource.List(false), seconds)
-		time.Sleep(time.Duration(pollTime) * time.Second)
-		seconds += pollTime
-		err = resource.Remove()
+		graph.schedule(stopped, config.Concurrency, func(name string) error {
+			resource := resourceMap[name]
+			if runErrs.failed(name, "list") {
+				log.Printf("[Skipping] %v could not be listed", name)
+				return fmt.Errorf("%v could not be listed", name)
+			}
+			progress.started(name)
+			defer progress.finished(name)
+			if runCheckpoint != nil {
+				runCheckpoint.startType(name)
+			}
+			err := parallelResourceDeletion(stopped, resource, config)
+			if err != nil {
+				runErrs.add(name, "remove", err)
+			}
+			finishType(name, err)
+			return err
+		}, func(name, dependency string) {
+			log.Printf("[Skipping] %v, dependency %v was not deleted", name, dependency)
+			err := fmt.Errorf("skipped, dependency %v was not deleted", dependency)
+			runErrs.add(name, "remove", err)
+			finishType(name, err)
+		})
 	}
 
-	// Add some info to the error
-	if err != nil {
-		detailedError := fmt.Errorf("[Error] Resource: %v. Items: %v. Details of error below:\n %v", resource.Name(), resource.List(false), err.Error())
-		err = detailedError
+	if stopped.Err() != nil {
+		progress.print(config.Project)
+		runErrs.add("Run", "remove", fmt.Errorf("interrupted, remaining resource types were not deleted"))
 	}
 
-	return err
+	// The project itself is deleted last, only once every resource type is done
+	if config.NoKeepProject {
+		switch {
+		case !config.NoDryRun:
+			if err := dryRunProjectDeletion(config, report); err != nil {
+				runErrs.add("Project", "list", err)
+			}
+		case runErrs.errorOrNil() != nil:
+			log.Printf("[Skipping] Project %v is kept, not every resource was deleted", config.Project)
+			err := fmt.Errorf("kept, not every resource was deleted")
+			runErrs.add("Project", "remove", err)
+			report.recordProject(actionFailed, err)
+		default:
+			err := deleteProject(config, stopped, report)
+			if err != nil {
+				runErrs.add("Project", "remove", err)
+				report.recordProject(actionFailed, err)
+			} else {
+				report.recordProject(actionDeleted, nil)
+			}
+		}
+	}
+
+	log.Printf("-- Deletion complete for project %v (dry-run: %v) (keep-project: %v) --\n", config.Project, !config.NoDryRun, !config.NoKeepProject)
+
+	return runErrs.errorOrNil()
 }
 
-func deleteProject(config config.Config) error {
-	ctx := config.Context
-	client, err := cloudresourcemanager.NewService(ctx)
-	if err != nil {
-		return err
+// listResources - lists every resource type in parallel, errors are collected per type
+func listResources(resourceMap map[string]Resource, runErrs *runErrors) {
+	var lists sync.WaitGroup
+	for _, resource := range resourceMap {
+		resource := resource
+		lists.Add(1)
+		go func() {
+			defer lists.Done()
+			log.Println("[Info] Retrieving list of resources for", resource.Name())
+			if _, err := resource.List(true); err != nil {
+				log.Printf("[Error] Unable to list %v: %v", resource.Name(), err)
+				runErrs.add(resource.Name(), "list", err)
+			}
+		}()
 	}
+	lists.Wait()
+}
 
-	deleteProjectCall := client.Projects.Delete(config.Project)
-	deleteProject, err := deleteProjectCall.Do()
-
-	if err != nil {
-		return err
+// parallelResourceDeletion - removes the items of resource, retrying until stopped is cancelled or the timeout passed
+func parallelResourceDeletion(stopped context.Context, resource Resource, config config.Config) error {
+	if len(resource.ToSlice()) == 0 {
+		log.Println("[Skipping] No", resource.Name(), "items to delete")
+		return nil
 	}
 
-	var updateOpStatus string
+	timeOut := config.Timeout
+	pollTime := config.PollTime
 	seconds := 0
-	for updateOpStatus != "DONE" {
-		log.Printf("[Info] Removing project %v (%v seconds)", config.Project, seconds)
 
-		operationCall := client.Operations.Get(deleteProject.Name)
-		checkOpp, err := operationCall.Do()
-		if err != nil {
-			return err
+	log.Println("[Remove] Removing", resource.Name(), "items:", resource.ToSlice())
+	err := resource.Remove()
+
+	// Unfortunately the API seems inconsistent with timings, so retry until any dependent resources delete
+	for retryableDeletionError(err) {
+		if _, listErr := resource.List(true); listErr != nil {
+			return listErr
 		}
 
-		if checkOpp.Done == true {
-			updateOpStatus = "DONE"
-		} else {
-			updateOpStatus = "RUNNING"
+		if stopped.Err() != nil {
+			return fmt.Errorf("[Error] Resource %v interrupted, not retrying. Details of error below:\n %v", resource.Name(), err.Error())
+		}
+		if seconds > timeOut {
+			return fmt.Errorf("[Error] Resource %v timed out whilst trying to delete. (%v seconds). Details of error below:\n %v", resource.Name(), timeOut, err.Error())
 		}
 
-		time.Sleep(time.Duration(config.PollTime) * time.Second)
-		seconds += config.PollTime
-		if seconds > config.Timeout {
-			return fmt.Errorf("[Error] Project removal timed out for %v (%v seconds)", config.Project, config.Timeout)
+		log.Printf("[Remove] In use Resource: %v. Items: %v. Waiting before retrying delete. (%v seconds)", resource.Name(), resource.ToSlice(), seconds)
+		select {
+		case <-stopped.Done():
+			// Reported at the start of the next retry, once the remaining items are listed
+			continue
+		case <-time.After(time.Duration(pollTime) * time.Second):
 		}
+		seconds += pollTime
+		err = resource.Remove()
 	}
-	log.Printf("[Info] Project removal completed for %v (%v seconds)", config.Project, seconds)
-
-	return nil
-}
 
-// apiErrorCheck - Not proud of this workaround for the inconsistent api timings, suggestions welcome
-func apiErrorCheck(err error) bool {
-	if err == nil {
-		return false
-	}
-	errorDescriptors := []string{
-		"resourceInUseByAnotherResource",
-		"resourceNotReady",
-		// Interestingly in the case of instancegroups managed by GKE, listing them after deletion can often give back a ghost list
-		"googleapi: Error 404",
-	}
-	for _, errorDesc := range errorDescriptors {
-		if strings.Contains(err.Error(), errorDesc) {
-			return true
-		}
+	// Add some info to the error
+	if err != nil {
+		detailedError := fmt.Errorf("[Error] Resource: %v. Items: %v. Error class: %v. Details of error below:\n %v", resource.Name(), resource.ToSlice(), classifyAPIError(err), err.Error())
+		err = detailedError
 	}
-	return false
+
+	return err
 }
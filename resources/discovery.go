@@ -0,0 +1,105 @@
+package resources
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/ianbrown78/gcp-nuke/config"
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+// ProjectSelector - selects projects below folders or organizations by their labels
+type ProjectSelector struct {
+	// Parents - eg. folders/1234 or organizations/5678, projects in nested folders are included
+	Parents []string
+	// Labels - key=value or key, a project has to match every one of them
+	Labels []string
+}
+
+// CheckProjectSelector - validates parents and labels
+func CheckProjectSelector(selector ProjectSelector) error {
+	for _, parent := range selector.Parents {
+		kind, id, _ := strings.Cut(parent, "/")
+		if (kind != "folders" && kind != "organizations") || id == "" || strings.Contains(id, "/") {
+			return fmt.Errorf("invalid parent %v, expected folders/<id> or organizations/<id>", parent)
+		}
+	}
+	for _, label := range selector.Labels {
+		if key, _, _ := strings.Cut(label, "="); key == "" {
+			return fmt.Errorf("invalid label selector %v, expected key=value or key", label)
+		}
+	}
+	if len(selector.Labels) > 0 && len(selector.Parents) == 0 {
+		return fmt.Errorf("label selectors need a parent folder or organization")
+	}
+	return nil
+}
+
+// labelsSelected - whether labels match every selector
+func labelsSelected(labels map[string]string, selectors []string) bool {
+	for _, selector := range selectors {
+		key, value, hasValue := strings.Cut(selector, "=")
+		actual, exists := labels[key]
+		if !exists || (hasValue && actual != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// DiscoverProjects - sorted ids of the active projects below the parents of the selector, which match its labels.
+// config is only used for the API client.
+func DiscoverProjects(config config.Config, selector ProjectSelector) ([]string, error) {
+	client, err := cloudresourcemanager.NewService(config.Context, clientOptions(config, "cloudresourcemanager")...)
+	if err != nil {
+		return nil, err
+	}
+	parents, err := nestedFolders(config, client, selector.Parents)
+	if err != nil {
+		return nil, err
+	}
+
+	projects := []string{}
+	for _, parent := range parents {
+		// Terms of a search query are or-ed, so parent and labels are checked here rather than in the query
+		err := client.Projects.Search().Query("parent:"+parent).Pages(config.Context, func(response *cloudresourcemanager.SearchProjectsResponse) error {
+			for _, project := range response.Projects {
+				if project.Parent != parent || project.State != "ACTIVE" || !labelsSelected(project.Labels, selector.Labels) {
+					continue
+				}
+				log.Printf("[Discovered] Project %v [parent: %v labels: %v]", project.ProjectId, parent, project.Labels)
+				projects = append(projects, project.ProjectId)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to search the projects of %v: %v", parent, err)
+		}
+	}
+	sort.Strings(projects)
+	return projects, nil
+}
+
+// nestedFolders - the parents and every folder below them. Projects are only found below their direct parent, so
+// every nested folder has to be searched as well.
+func nestedFolders(config config.Config, client *cloudresourcemanager.Service, parents []string) ([]string, error) {
+	folders := []string{}
+	pending := append([]string{}, parents...)
+	for len(pending) > 0 {
+		parent := pending[0]
+		pending = pending[1:]
+		folders = append(folders, parent)
+		err := client.Folders.List().Parent(parent).Pages(config.Context, func(response *cloudresourcemanager.ListFoldersResponse) error {
+			for _, folder := range response.Folders {
+				pending = append(pending, folder.Name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the folders of %v: %v", parent, err)
+		}
+	}
+	return folders, nil
+}
@@ -0,0 +1,64 @@
+package resources
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ianbrown78/gcp-nuke/internal/fakegcp"
+)
+
+func TestDiscoverProjects(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	foldersPath := fakegcp.CloudResourceManager + "/folders"
+	projectsPath := fakegcp.CloudResourceManager + "/projects"
+	server.Seed(foldersPath, "folders/2", map[string]interface{}{"name": "folders/2", "parent": "folders/1"})
+	server.Seed(foldersPath, "folders/3", map[string]interface{}{"name": "folders/3", "parent": "folders/2"})
+	server.Seed(foldersPath, "folders/9", map[string]interface{}{"name": "folders/9", "parent": "organizations/1"})
+	seedDiscovered := func(id, parent, state string, labels map[string]interface{}) {
+		server.Seed(projectsPath, id, map[string]interface{}{
+			"name": "projects/" + id, "projectId": id, "parent": parent, "state": state, "labels": labels,
+		})
+	}
+	seedDiscovered("sandbox-a", "folders/1", "ACTIVE", map[string]interface{}{"env": "sandbox"})
+	seedDiscovered("sandbox-b", "folders/3", "ACTIVE", map[string]interface{}{"env": "sandbox", "team": "data"})
+	seedDiscovered("prod-a", "folders/2", "ACTIVE", map[string]interface{}{"env": "prod"})
+	seedDiscovered("sandbox-deleted", "folders/2", "DELETE_REQUESTED", map[string]interface{}{"env": "sandbox"})
+	seedDiscovered("sandbox-other", "folders/9", "ACTIVE", map[string]interface{}{"env": "sandbox"})
+
+	tests := []struct {
+		selector ProjectSelector
+		expected []string
+	}{
+		{ProjectSelector{Parents: []string{"folders/1"}}, []string{"prod-a", "sandbox-a", "sandbox-b"}},
+		{ProjectSelector{Parents: []string{"folders/1"}, Labels: []string{"env=sandbox"}}, []string{"sandbox-a", "sandbox-b"}},
+		{ProjectSelector{Parents: []string{"folders/1"}, Labels: []string{"env=sandbox", "team"}}, []string{"sandbox-b"}},
+		{ProjectSelector{Parents: []string{"folders/3", "organizations/1"}}, []string{"sandbox-b", "sandbox-other"}},
+	}
+	for _, test := range tests {
+		projects, err := DiscoverProjects(testConfig(server), test.selector)
+		if err != nil {
+			t.Fatalf("discovering %+v: %v", test.selector, err)
+		}
+		if !reflect.DeepEqual(projects, test.expected) {
+			t.Errorf("discovering %+v: got %v, expected %v", test.selector, projects, test.expected)
+		}
+	}
+}
+
+func TestCheckProjectSelector(t *testing.T) {
+	invalid := []ProjectSelector{
+		{Parents: []string{"projects/1"}},
+		{Parents: []string{"folders/"}},
+		{Parents: []string{"folders/1"}, Labels: []string{"=sandbox"}},
+		{Labels: []string{"env=sandbox"}},
+	}
+	for _, selector := range invalid {
+		if CheckProjectSelector(selector) == nil {
+			t.Errorf("expected %+v to be invalid", selector)
+		}
+	}
+	if err := CheckProjectSelector(ProjectSelector{Parents: []string{"organizations/1"}, Labels: []string{"env"}}); err != nil {
+		t.Errorf("expected a valid selector: %v", err)
+	}
+}
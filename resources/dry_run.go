@@ -2,12 +2,23 @@ package resources
 
 import (
 	"log"
+	"sort"
 
 	"github.com/ianbrown78/gcp-nuke/config"
 )
 
 func parallelDryRun(resourceMap map[string]Resource, resource Resource, config config.Config) {
-	resourceList := resource.List(false)
+	filtered := resource.Filtered()
+	filteredNames := []string{}
+	for name := range filtered {
+		filteredNames = append(filteredNames, name)
+	}
+	sort.Strings(filteredNames)
+	for _, name := range filteredNames {
+		log.Printf("[Dryrun] [Filtered] Resource type %v item %v is kept, %v [project: %v]", resource.Name(), name, filtered[name], config.Project)
+	}
+
+	resourceList := resource.ToSlice()
 	if len(resourceList) == 0 {
 		log.Printf("[Dryrun] [Skip] Resource type %v has nothing to destroy [project: %v]", resource.Name(), config.Project)
 		return
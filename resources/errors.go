@@ -0,0 +1,142 @@
+package resources
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ianbrown78/gcp-nuke/helpers"
+
+	"google.golang.org/api/googleapi"
+)
+
+// apiErrorClass - what a failed API call means for gcp-nuke, independent of the service which returned it
+type apiErrorClass int
+
+const (
+	apiErrorOther apiErrorClass = iota
+	// apiErrorDisabled - the service API is not enabled in the project
+	apiErrorDisabled
+	apiErrorPermissionDenied
+	// apiErrorNotFound - the item is already gone
+	apiErrorNotFound
+	// apiErrorInUse - the item is still referenced by another resource, or busy with another operation
+	apiErrorInUse
+	// apiErrorRateLimited - quota or rate limit exceeded
+	apiErrorRateLimited
+	apiErrorPrecondition
+)
+
+// String -
+func (c apiErrorClass) String() string {
+	switch c {
+	case apiErrorDisabled:
+		return "api disabled"
+	case apiErrorPermissionDenied:
+		return "permission denied"
+	case apiErrorNotFound:
+		return "not found"
+	case apiErrorInUse:
+		return "in use"
+	case apiErrorRateLimited:
+		return "rate limited"
+	case apiErrorPrecondition:
+		return "precondition failed"
+	}
+	return "other"
+}
+
+// Reasons as returned in the errors list of JSON APIs, in the google.rpc.ErrorInfo details of newer APIs,
+// or as error codes of failed long running operations
+var (
+	disabledReasons         = []string{"accessNotConfigured", "SERVICE_DISABLED"}
+	inUseReasons            = []string{"resourceInUseByAnotherResource", "resourceNotReady", "operationInProgress", "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE", "RESOURCE_NOT_READY", "ABORTED"}
+	rateLimitedReasons      = []string{"rateLimitExceeded", "userRateLimitExceeded", "quotaExceeded", "RATE_LIMIT_EXCEEDED", "RESOURCE_EXHAUSTED"}
+	preconditionReasons     = []string{"conditionNotMet", "failedPrecondition", "FAILED_PRECONDITION"}
+	notFoundReasons         = []string{"notFound", "NOT_FOUND", "RESOURCE_NOT_FOUND"}
+	permissionDeniedReasons = []string{"forbidden", "PERMISSION_DENIED"}
+)
+
+// classifyAPIError - classifies an error returned by a Google API client call, or by a long running operation
+func classifyAPIError(err error) apiErrorClass {
+	var opErr *operationError
+	if errors.As(err, &opErr) {
+		return classifyReasons(opErr.reasons, 0)
+	}
+
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return apiErrorOther
+	}
+	return classifyReasons(apiErrorReasons(apiErr), apiErr.Code)
+}
+
+// classifyReasons - classifies by machine readable reasons first, then by HTTP status code if there is one
+func classifyReasons(reasons []string, code int) apiErrorClass {
+	switch {
+	case containsAny(reasons, disabledReasons):
+		return apiErrorDisabled
+	case containsAny(reasons, rateLimitedReasons) || code == http.StatusTooManyRequests:
+		return apiErrorRateLimited
+	case containsAny(reasons, inUseReasons) || code == http.StatusConflict:
+		return apiErrorInUse
+	case containsAny(reasons, preconditionReasons) || code == http.StatusPreconditionFailed:
+		return apiErrorPrecondition
+	case containsAny(reasons, notFoundReasons) || code == http.StatusNotFound:
+		return apiErrorNotFound
+	case containsAny(reasons, permissionDeniedReasons) || code == http.StatusForbidden:
+		return apiErrorPermissionDenied
+	}
+	return apiErrorOther
+}
+
+// apiErrorReasons - collects every machine readable reason / status of an error
+func apiErrorReasons(apiErr *googleapi.Error) []string {
+	reasons := []string{}
+	for _, item := range apiErr.Errors {
+		reasons = append(reasons, item.Reason)
+	}
+	for _, detail := range apiErr.Details {
+		if detailMap, ok := detail.(map[string]interface{}); ok {
+			if reason, ok := detailMap["reason"].(string); ok {
+				reasons = append(reasons, reason)
+			}
+		}
+	}
+
+	// The canonical status, eg. FAILED_PRECONDITION, is only part of the raw body
+	body := struct {
+		Error struct {
+			Status string `json:"status"`
+		} `json:"error"`
+	}{}
+	if json.Unmarshal([]byte(apiErr.Body), &body) == nil && body.Error.Status != "" {
+		reasons = append(reasons, body.Error.Status)
+	}
+	return reasons
+}
+
+func containsAny(values, candidates []string) bool {
+	for _, candidate := range candidates {
+		if helpers.SliceContains(values, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryableDeletionError - check if a failed deletion should be retried after refreshing the resource list
+func retryableDeletionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch classifyAPIError(err) {
+	case apiErrorInUse, apiErrorRateLimited, apiErrorPrecondition:
+		return true
+	case apiErrorNotFound:
+		// Already gone. Instance groups managed by GKE in particular can linger in listings after deletion,
+		// refreshing the list and retrying drops them.
+		return true
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package resources
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ianbrown78/gcp-nuke/config"
+	"github.com/ianbrown78/gcp-nuke/helpers"
+)
+
+// CheckFilterTypes - validates that filters are only defined for registered resources, and are valid themselves
+func CheckFilterTypes(filters map[string][]config.Filter) error {
+	for name, resourceFilters := range filters {
+		if _, exists := resourceFactories[name]; !exists {
+			return fmt.Errorf("filters defined for unknown resource type %v", name)
+		}
+		for _, filter := range resourceFilters {
+			if err := filter.Validate(); err != nil {
+				return fmt.Errorf("%v: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// filtered - check if an item has to be kept because of a filter or its age, and if so record why.
+// The properties of every item are recorded as well.
+func (b *ResourceBase) filtered(resourceName, itemName string, properties DefaultResourceProperties) bool {
+	b.propertiesMap.Store(itemName, properties)
+	if b.config.Plan != nil {
+		created, planned := b.config.Plan[resourceName][itemName]
+		if !planned {
+			b.filteredMap.Store(itemName, "not part of the plan")
+			return true
+		}
+		if created != planIdentity(properties) {
+			b.filteredMap.Store(itemName, "not part of the plan, recreated since it was made")
+			return true
+		}
+	}
+	for _, filter := range b.config.Filters[resourceName] {
+		if filter.Matches(itemName, properties.labels) {
+			b.filteredMap.Store(itemName, fmt.Sprintf("matched filter %v", filter))
+			return true
+		}
+	}
+
+	// Global items serve every region, so a run restricted to some of them leaves them alone unless asked to
+	restricted := len(b.config.Zones) > 0 || len(b.config.Regions) > 0
+	if restricted && !b.config.IncludeGlobal && properties.location() == "global" {
+		b.filteredMap.Store(itemName, "global, the run is restricted to regions or zones, see --include-global")
+		return true
+	}
+
+	if b.config.OlderThan == 0 && b.config.NewerThan == 0 {
+		return false
+	}
+	// Without a creation time the age is unknown, so err on the side of keeping the item. An update time only tells
+	// that the item is at least that old, which is not enough for --newer-than.
+	if properties.created.IsZero() || (b.config.NewerThan > 0 && properties.createdIsUpdate) {
+		b.filteredMap.Store(itemName, "creation time unknown")
+		return true
+	}
+	age := time.Since(properties.created).Truncate(time.Second)
+	if b.config.OlderThan > 0 && age < b.config.OlderThan {
+		b.filteredMap.Store(itemName, fmt.Sprintf("created %v ago, not older than %v", age, b.config.OlderThan))
+		return true
+	}
+	if b.config.NewerThan > 0 && age > b.config.NewerThan {
+		b.filteredMap.Store(itemName, fmt.Sprintf("created %v ago, not newer than %v", age, b.config.NewerThan))
+		return true
+	}
+	return false
+}
+
+// resetFiltered - clears the filtered items and properties, to be called whenever the resource map is refreshed
+func (b *ResourceBase) resetFiltered() {
+	helpers.ClearSyncMap(&b.filteredMap)
+	helpers.ClearSyncMap(&b.propertiesMap)
+}
+
+// filteredItems - items which were kept during the last listing, with the reason why
+func (b *ResourceBase) filteredItems() map[string]string {
+	items := make(map[string]string)
+	b.filteredMap.Range(func(key, value interface{}) bool {
+		items[key.(string)] = value.(string)
+		return true
+	})
+	return items
+}
+
+// itemProperties - properties of the items of the last listing, including filtered ones
+func (b *ResourceBase) itemProperties() map[string]DefaultResourceProperties {
+	items := make(map[string]DefaultResourceProperties)
+	b.propertiesMap.Range(func(key, value interface{}) bool {
+		items[key.(string)] = value.(DefaultResourceProperties)
+		return true
+	})
+	return items
+}
+
+// parseCreationTime - parses the RFC3339 timestamps returned by most APIs, unknown times are zero
+func parseCreationTime(timestamp string) time.Time {
+	created, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+	return created
+}
@@ -3,8 +3,6 @@ package resources
 import (
 	"fmt"
 	"log"
-	"sync"
-	"time"
 
 	"github.com/ianbrown78/gcp-nuke/config"
 	"github.com/ianbrown78/gcp-nuke/helpers"
@@ -21,14 +19,7 @@ type ComputeNetworks struct {
 }
 
 func init() {
-	computeService, err := compute.NewService(Ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	computeResource := ComputeNetworks{
-		serviceClient: computeService,
-	}
-	register(&computeResource)
+	register(func() Resource { return &ComputeNetworks{} })
 }
 
 // Name - Name of the resourceLister for ComputeNetworks
@@ -42,30 +33,57 @@ func (c *ComputeNetworks) ToSlice() (slice []string) {
 
 }
 
-// Setup - populates the struct
-func (c *ComputeNetworks) Setup(config config.Config) {
+// Filtered - Items of ComputeNetworks which were kept by a filter during the last listing
+func (c *ComputeNetworks) Filtered() map[string]string {
+	return c.base.filteredItems()
+}
+
+// Properties - Properties of the items of ComputeNetworks seen during the last listing, including filtered ones
+func (c *ComputeNetworks) Properties() map[string]DefaultResourceProperties {
+	return c.base.itemProperties()
+}
+
+// Setup - populates the struct and creates the API client
+func (c *ComputeNetworks) Setup(config config.Config) error {
 	c.base.config = config
 
+	computeService, err := compute.NewService(config.Context, clientOptions(config, "compute")...)
+	if err != nil {
+		return err
+	}
+	c.serviceClient = computeService
+	return nil
 }
 
 // List - Returns a list of all ComputeNetworks
-func (c *ComputeNetworks) List(refreshCache bool) []string {
+func (c *ComputeNetworks) List(refreshCache bool) ([]string, error) {
 	if !refreshCache {
-		return c.ToSlice()
+		return c.ToSlice(), nil
 	}
 	// Refresh resource map
-	c.resourceMap = sync.Map{}
+	helpers.ClearSyncMap(&c.resourceMap)
+	c.base.resetFiltered()
 
-	networkListCall := c.serviceClient.Networks.List(c.base.config.Project)
-	networkList, err := networkListCall.Do()
+	err := c.serviceClient.Networks.List(c.base.config.Project).Pages(c.base.config.Context, func(networkList *compute.NetworkList) error {
+		for _, network := range networkList.Items {
+			instanceResource := DefaultResourceProperties{
+				created: parseCreationTime(network.CreationTimestamp),
+			}
+			if c.base.filtered(c.Name(), network.Name, instanceResource) {
+				continue
+			}
+			c.resourceMap.Store(network.Name, instanceResource)
+		}
+		return nil
+	})
 	if err != nil {
-		log.Fatal(err)
-	}
-
-	for _, network := range networkList.Items {
-		c.resourceMap.Store(network.Name, nil)
+		if classifyAPIError(err) == apiErrorDisabled {
+			log.Println("Compute Engine API not enabled. Skipping.")
+			return c.ToSlice(), nil
+		}
+		return nil, err
 	}
-	return c.ToSlice()
+	return c.ToSlice(), nil
 }
 
 // Dependencies - Returns a List of resource names to check for
@@ -74,6 +92,11 @@ func (c *ComputeNetworks) Dependencies() []string {
 	return []string{a.Name()}
 }
 
+// Service - API service of the items of ComputeNetworks
+func (c *ComputeNetworks) Service() string {
+	return "compute.googleapis.com"
+}
+
 // Remove -
 func (c *ComputeNetworks) Remove() error {
 
@@ -86,31 +109,17 @@ func (c *ComputeNetworks) Remove() error {
 		// Parallel network deletion
 		errs.Go(func() error {
 			deleteCall := c.serviceClient.Networks.Delete(c.base.config.Project, networkID)
-			operation, err := deleteCall.Do()
+			operation, err := deleteCall.Context(c.base.config.Context).Do()
 			if err != nil {
 				return err
 			}
-			var opStatus string
-			seconds := 0
-			for opStatus != "DONE" {
-				log.Printf("[Info] Resource currently being deleted %v [type: %v project: %v] (%v seconds)", networkID, c.Name(), c.base.config.Project, seconds)
-
-				operationCall := c.serviceClient.GlobalOperations.Get(c.base.config.Project, operation.Name)
-				checkOpp, err := operationCall.Do()
-				if err != nil {
-					return err
-				}
-				opStatus = checkOpp.Status
-
-				time.Sleep(time.Duration(c.base.config.PollTime) * time.Second)
-				seconds += c.base.config.PollTime
-				if seconds > c.base.config.Timeout {
-					return fmt.Errorf("[Error] Resource deletion timed out for %v [type: %v project: %v] (%v seconds)", networkID, c.Name(), c.base.config.Project, c.base.config.Timeout)
-				}
+			err = waitForOperation(c.base.config, fmt.Sprintf("deletion of %v [type: %v project: %v]", networkID, c.Name(), c.base.config.Project), computeOperation(c.serviceClient, c.base.config.Project, operation))
+			if err != nil {
+				return err
 			}
 			c.resourceMap.Delete(networkID)
 
-			log.Printf("[Info] Resource deleted %v [type: %v project: %v] (%v seconds)", networkID, c.Name(), c.base.config.Project, seconds)
+			log.Printf("[Info] Resource deleted %v [type: %v project: %v]", networkID, c.Name(), c.base.config.Project)
 			return nil
 		})
 		return true
@@ -0,0 +1,192 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// dependencyGraph - resource types and the types which have to be deleted before them
+type dependencyGraph struct {
+	dependencies map[string][]string
+	dependents   map[string][]string
+}
+
+// newDependencyGraph - builds the graph of the given resources. Every dependency has to be a registered resource type,
+// dependencies which are registered but not part of resources are left out. Cycles are an error.
+func newDependencyGraph(resources map[string]Resource) (*dependencyGraph, error) {
+	graph := &dependencyGraph{
+		dependencies: make(map[string][]string),
+		dependents:   make(map[string][]string),
+	}
+	for name, resource := range resources {
+		graph.dependencies[name] = []string{}
+		for _, dependency := range resource.Dependencies() {
+			if _, registered := resourceFactories[dependency]; !registered {
+				return nil, fmt.Errorf("resource type %v depends on %v, which is not a registered resource type", name, dependency)
+			}
+			if _, selected := resources[dependency]; !selected {
+				continue
+			}
+			graph.dependencies[name] = append(graph.dependencies[name], dependency)
+			graph.dependents[dependency] = append(graph.dependents[dependency], name)
+		}
+	}
+
+	if cycle := graph.cycle(); cycle != nil {
+		return nil, fmt.Errorf("resource type dependencies form a cycle: %v", strings.Join(cycle, " -> "))
+	}
+	return graph, nil
+}
+
+// CheckDependencyGraph - validates the dependencies of all registered resource types
+func CheckDependencyGraph() error {
+	_, err := newDependencyGraph(registeredResources())
+	return err
+}
+
+// cycle - returns the resource types of a dependency cycle, or nil if there is none
+func (g *dependencyGraph) cycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	path := []string{}
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		state[name] = visiting
+		path = append(path, name)
+		for _, dependency := range g.dependencies[name] {
+			switch state[dependency] {
+			case visiting:
+				for i, onPath := range path {
+					if onPath == dependency {
+						return append(append([]string{}, path[i:]...), dependency)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dependency); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, name := range g.names() {
+		if state[name] == unvisited {
+			if cycle := visit(name); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// names - sorted resource types of the graph
+func (g *dependencyGraph) names() []string {
+	names := []string{}
+	for name := range g.dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// waves - resource types in topological order, each wave only depends on types of earlier waves
+func (g *dependencyGraph) waves() [][]string {
+	remaining := make(map[string]int)
+	for name, dependencies := range g.dependencies {
+		remaining[name] = len(dependencies)
+	}
+
+	waves := [][]string{}
+	for len(remaining) > 0 {
+		wave := []string{}
+		for name, count := range remaining {
+			if count == 0 {
+				wave = append(wave, name)
+			}
+		}
+		sort.Strings(wave)
+		for _, name := range wave {
+			delete(remaining, name)
+			for _, dependent := range g.dependents[name] {
+				remaining[dependent]--
+			}
+		}
+		waves = append(waves, wave)
+	}
+	return waves
+}
+
+// schedule - runs run for every resource type with at most concurrency types at a time. A type starts as soon as
+// all of its dependencies completed without error. Types with a failed or skipped dependency are not run, skip is
+// called with the first such dependency instead. A concurrency below 1 means no limit. Once stopped is cancelled
+// no further types are started, running ones are waited for.
+func (g *dependencyGraph) schedule(stopped context.Context, concurrency int, run func(name string) error, skip func(name, dependency string)) {
+	if concurrency < 1 {
+		concurrency = len(g.dependencies)
+	}
+	done := make(map[string]chan struct{})
+	for name := range g.dependencies {
+		done[name] = make(chan struct{})
+	}
+	var failedMutex sync.Mutex
+	failed := make(map[string]bool)
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for _, name := range g.names() {
+		name := name
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[name])
+
+			for _, dependency := range g.dependencies[name] {
+				<-done[dependency]
+				if stopped.Err() != nil {
+					break
+				}
+				failedMutex.Lock()
+				dependencyFailed := failed[dependency]
+				if dependencyFailed {
+					failed[name] = true
+				}
+				failedMutex.Unlock()
+				if dependencyFailed {
+					skip(name, dependency)
+					return
+				}
+			}
+
+			err := stopped.Err()
+			if err == nil {
+				select {
+				case slots <- struct{}{}:
+					// Stopped while waiting for a slot, both cases may be ready at once
+					if err = stopped.Err(); err == nil {
+						err = run(name)
+					}
+					<-slots
+				case <-stopped.Done():
+					err = stopped.Err()
+				}
+			}
+			if err != nil {
+				failedMutex.Lock()
+				failed[name] = true
+				failedMutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,251 @@
+package resources
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ianbrown78/gcp-nuke/config"
+)
+
+// stubResource - resource type which only has a name and dependencies
+type stubResource struct {
+	name         string
+	dependencies []string
+}
+
+func (s *stubResource) Name() string                                     { return s.name }
+func (s *stubResource) ToSlice() []string                                { return nil }
+func (s *stubResource) Setup(config config.Config) error                 { return nil }
+func (s *stubResource) List(useCache bool) ([]string, error)             { return nil, nil }
+func (s *stubResource) Filtered() map[string]string                      { return nil }
+func (s *stubResource) Properties() map[string]DefaultResourceProperties { return nil }
+func (s *stubResource) Dependencies() []string                           { return s.dependencies }
+func (s *stubResource) Service() string                                  { return "stub.googleapis.com" }
+func (s *stubResource) Remove() error                                    { return nil }
+
+// stubResources - registers stub resource types for the duration of the test, as dependencies have to be registered
+func stubResources(t *testing.T, dependencies map[string][]string) map[string]Resource {
+	resources := make(map[string]Resource)
+	for name, dependsOn := range dependencies {
+		stub := &stubResource{name: name, dependencies: dependsOn}
+		resources[name] = stub
+		resourceFactories[name] = func() Resource { return stub }
+	}
+	t.Cleanup(func() {
+		for name := range resources {
+			delete(resourceFactories, name)
+		}
+	})
+	return resources
+}
+
+func TestCheckDependencyGraph(t *testing.T) {
+	if err := CheckDependencyGraph(); err != nil {
+		t.Fatalf("registered resource types: %v", err)
+	}
+}
+
+func TestDependencyGraphCycle(t *testing.T) {
+	resources := stubResources(t, map[string][]string{
+		"StubA": {"StubB"},
+		"StubB": {"StubC"},
+		"StubC": {"StubA"},
+		"StubD": {},
+	})
+
+	_, err := newDependencyGraph(resources)
+	if err == nil || !strings.Contains(err.Error(), "StubA -> StubB -> StubC -> StubA") {
+		t.Fatalf("expected the cycle to be reported, got %v", err)
+	}
+}
+
+func TestDependencyGraphUnregistered(t *testing.T) {
+	resources := stubResources(t, map[string][]string{
+		"StubA": {"StubMissing"},
+	})
+
+	_, err := newDependencyGraph(resources)
+	if err == nil || !strings.Contains(err.Error(), "StubMissing") {
+		t.Fatalf("expected the unregistered dependency to be reported, got %v", err)
+	}
+}
+
+func TestDependencyGraphWaves(t *testing.T) {
+	resources := stubResources(t, map[string][]string{
+		"StubA": {"StubB", "StubC"},
+		"StubB": {"StubC"},
+		"StubC": {},
+		"StubD": {},
+		// Registered but not selected, so not waited on
+		"StubE": {},
+	})
+	delete(resources, "StubE")
+	resources["StubD"] = &stubResource{name: "StubD", dependencies: []string{"StubE"}}
+
+	graph, err := newDependencyGraph(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{{"StubC", "StubD"}, {"StubB"}, {"StubA"}}
+	if waves := graph.waves(); !reflect.DeepEqual(waves, expected) {
+		t.Errorf("expected waves %v, got %v", expected, waves)
+	}
+}
+
+func TestDependencyGraphSchedule(t *testing.T) {
+	resources := stubResources(t, map[string][]string{
+		"StubA": {"StubB"},
+		"StubB": {"StubC"},
+		"StubC": {},
+		"StubD": {"StubE"},
+		"StubE": {},
+		"StubF": {},
+	})
+	graph, err := newDependencyGraph(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mutex sync.Mutex
+	finished := map[string]bool{}
+	skipped := map[string]string{}
+	running, maxRunning := 0, 0
+	graph.schedule(context.Background(), 2, func(name string) error {
+		mutex.Lock()
+		for _, dependency := range graph.dependencies[name] {
+			if !finished[dependency] {
+				t.Errorf("%v started before its dependency %v finished", name, dependency)
+			}
+		}
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		running--
+		finished[name] = true
+		if name == "StubE" {
+			return fmt.Errorf("failed")
+		}
+		return nil
+	}, func(name, dependency string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		skipped[name] = dependency
+	})
+
+	if maxRunning > 2 {
+		t.Errorf("expected at most 2 types at a time, got %v", maxRunning)
+	}
+	for _, name := range []string{"StubA", "StubB", "StubC", "StubE", "StubF"} {
+		if !finished[name] {
+			t.Errorf("%v was not run", name)
+		}
+	}
+	if finished["StubD"] || skipped["StubD"] != "StubE" {
+		t.Errorf("expected StubD to be skipped because of StubE, got run: %v, skipped: %v", finished["StubD"], skipped)
+	}
+}
+
+func TestDependencyGraphScheduleStopped(t *testing.T) {
+	resources := stubResources(t, map[string][]string{
+		"StubA": {"StubB"},
+		"StubB": {},
+		"StubC": {},
+	})
+	graph, err := newDependencyGraph(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopped, stop := context.WithCancel(context.Background())
+	defer stop()
+	var mutex sync.Mutex
+	finished := map[string]bool{}
+	skipped := map[string]string{}
+	graph.schedule(stopped, 1, func(name string) error {
+		// The first type stops the run, it still completes
+		stop()
+		mutex.Lock()
+		defer mutex.Unlock()
+		finished[name] = true
+		return nil
+	}, func(name, dependency string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		skipped[name] = dependency
+	})
+
+	if len(finished) != 1 {
+		t.Errorf("expected only the first type to run, got %v", finished)
+	}
+	if len(skipped) != 0 {
+		t.Errorf("expected stopped types not to be reported as skipped, got %v", skipped)
+	}
+}
+
+func TestWriteResourceTypes(t *testing.T) {
+	stubResources(t, map[string][]string{
+		"StubA": {"StubB"},
+		"StubB": {},
+	})
+
+	output := &bytes.Buffer{}
+	if err := WriteResourceTypes(output, TypesJSON); err != nil {
+		t.Fatalf("writing JSON failed: %v", err)
+	}
+	types := []ResourceType{}
+	if err := json.Unmarshal(output.Bytes(), &types); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	waves := make(map[string]int)
+	for _, resourceType := range types {
+		waves[resourceType.Name] = resourceType.Wave
+		if resourceType.Service == "" {
+			t.Errorf("%v has no service", resourceType.Name)
+		}
+	}
+	if len(types) != len(resourceFactories) {
+		t.Errorf("expected %v types, got %v", len(resourceFactories), len(types))
+	}
+	for _, resourceType := range types {
+		for _, dependency := range resourceType.Dependencies {
+			if waves[dependency] >= resourceType.Wave {
+				t.Errorf("%v in wave %v, its dependency %v in wave %v", resourceType.Name, resourceType.Wave, dependency, waves[dependency])
+			}
+		}
+	}
+
+	output.Reset()
+	if err := WriteResourceTypes(output, TypesDOT); err != nil {
+		t.Fatalf("writing DOT failed: %v", err)
+	}
+	for _, expected := range []string{"digraph deletion_order {", `"StubA" -> "StubB";`, `"StubB" [label="StubB\nstub.googleapis.com"];`} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("DOT output is missing %v:\n%v", expected, output.String())
+		}
+	}
+
+	output.Reset()
+	if err := WriteResourceTypes(output, TypesText); err != nil {
+		t.Fatalf("writing text failed: %v", err)
+	}
+	if !strings.Contains(output.String(), "StubA") {
+		t.Errorf("text output is missing StubA:\n%v", output.String())
+	}
+	if err := WriteResourceTypes(output, "yaml"); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
@@ -2,16 +2,25 @@ package resources
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"path"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/ianbrown78/gcp-nuke/config"
+	"github.com/ianbrown78/gcp-nuke/helpers"
+	"golang.org/x/sync/syncmap"
 	"google.golang.org/api/compute/v1"
 )
 
 // ResourceBase -
 type ResourceBase struct {
-	config config.Config
+	config      config.Config
+	filteredMap syncmap.Map
+	// propertiesMap - properties of every item of the last listing, including filtered ones
+	propertiesMap syncmap.Map
 }
 
 // DefaultResourceProperties -
@@ -20,79 +29,277 @@ type DefaultResourceProperties struct {
 	zone      string
 	region    string
 	protected bool
+	labels    map[string]string
+	created   time.Time
+	// createdIsUpdate - created is the last update time, the item may be older
+	createdIsUpdate bool
+	// sizeBytes - estimated storage of the item, 0 if unknown
+	sizeBytes int64
 }
 
+// location - zone or region of the item, global if it has neither
+func (p DefaultResourceProperties) location() string {
+	switch {
+	case p.zone != "":
+		return p.zone
+	case p.region != "":
+		return p.region
+	}
+	return "global"
+}
+
+// gibibyte - the GB of the sizes reported by the APIs, which are binary gigabytes
+const gibibyte = 1 << 30
+
 // Resource -
 type Resource interface {
 	Name() string
 	ToSlice() []string
-	Setup(config config.Config)
-	List(useCache bool) []string
+	Setup(config config.Config) error
+	List(useCache bool) ([]string, error)
+	Filtered() map[string]string
+	Properties() map[string]DefaultResourceProperties
 	Dependencies() []string
+	// Service - API service the items are deleted through, eg. compute.googleapis.com
+	Service() string
 	Remove() error
 }
 
 // Ctx = context
 var Ctx = context.Background()
-var resourceMap = make(map[string]Resource)
 
-func register(resource Resource) {
-	_, exists := resourceMap[resource.Name()]
+// resourceFactories - creates a new instance of every registered resource type, so that every project of a run
+// has its own
+var resourceFactories = make(map[string]func() Resource)
+
+func register(factory func() Resource) {
+	name := factory().Name()
+	_, exists := resourceFactories[name]
 	if exists {
-		log.Fatalf("a resource with the name %s already exists", resource.Name())
+		log.Fatalf("a resource with the name %s already exists", name)
+	}
+	resourceFactories[name] = factory
+}
+
+// registeredResources - new, unconfigured instances of every registered resource type
+func registeredResources() map[string]Resource {
+	resources := make(map[string]Resource)
+	for name, factory := range resourceFactories {
+		resources[name] = factory()
+	}
+	return resources
+}
+
+// GetResourceMap - returns new instances of the resources selected by the include / exclude types of the config,
+// set up for the run
+func GetResourceMap(config config.Config) (map[string]Resource, error) {
+	config, err := selectLocations(config)
+	if err != nil {
+		return nil, err
+	}
+	selected := make(map[string]Resource)
+	for name, factory := range resourceFactories {
+		if !resourceTypeSelected(name, config.IncludeTypes, config.ExcludeTypes) {
+			continue
+		}
+		resource := factory()
+		if err := resource.Setup(config); err != nil {
+			return nil, fmt.Errorf("unable to set up %v: %v", name, err)
+		}
+		selected[name] = resource
+	}
+
+	return selected, nil
+}
+
+// CheckResourceTypes - validates include / exclude types against the registered resources
+func CheckResourceTypes(includeTypes, excludeTypes []string) error {
+	if err := checkTypeNames(append(append([]string{}, includeTypes...), excludeTypes...)); err != nil {
+		return err
 	}
-	resourceMap[resource.Name()] = resource
+
+	// Dependencies which are not part of the run are not waited on, so deleting the dependent resource may fail
+	for _, name := range ResourceTypeNames() {
+		if !resourceTypeSelected(name, includeTypes, excludeTypes) {
+			continue
+		}
+		for _, dependency := range resourceFactories[name]().Dependencies() {
+			if !resourceTypeSelected(dependency, includeTypes, excludeTypes) {
+				log.Printf("[Warning] Resource type %v depends on %v, which is not selected. Its deletion will not wait for %v and may fail or time out.", name, dependency, dependency)
+			}
+		}
+	}
+	return nil
 }
 
-// GetResourceMap -
-func GetResourceMap(config config.Config) map[string]Resource {
-	for _, resource := range resourceMap {
-		resource.Setup(config)
+// checkTypeNames - every name has to be a registered resource type
+func checkTypeNames(names []string) error {
+	for _, name := range names {
+		if _, exists := resourceFactories[name]; !exists {
+			return fmt.Errorf("unknown resource type %v, valid types are: %v", name, strings.Join(ResourceTypeNames(), ", "))
+		}
 	}
+	return nil
+}
 
-	return resourceMap
+// ResourceTypeNames - sorted names of all registered resources
+func ResourceTypeNames() []string {
+	names := []string{}
+	for name := range resourceFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func resourceTypeSelected(name string, includeTypes, excludeTypes []string) bool {
+	if len(includeTypes) > 0 && !helpers.SliceContains(includeTypes, name) {
+		return false
+	}
+	return !helpers.SliceContains(excludeTypes, name)
 }
 
 // GetZones -
-func GetZones(defaultContext context.Context, project string) []string {
+func GetZones(config config.Config) ([]string, error) {
+	project := config.Project
 	log.Println("[Info] Retrieving zones for project:", project)
-	serviceClient, err := compute.NewService(defaultContext)
-	if err != nil {
-		log.Fatal(err)
-	}
-	zoneListCall := serviceClient.Zones.List(project)
-	zoneList, err := zoneListCall.Do()
+	serviceClient, err := compute.NewService(config.Context, clientOptions(config, "compute")...)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-
 	zoneStringSlice := []string{}
-	for _, zone := range zoneList.Items {
-		zoneNameSplit := strings.Split(zone.Name, "/")
-		zoneStringSlice = append(zoneStringSlice, zoneNameSplit[len(zoneNameSplit)-1])
+	err = serviceClient.Zones.List(project).Pages(config.Context, func(zoneList *compute.ZoneList) error {
+		for _, zone := range zoneList.Items {
+			zoneNameSplit := strings.Split(zone.Name, "/")
+			zoneStringSlice = append(zoneStringSlice, zoneNameSplit[len(zoneNameSplit)-1])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return zoneStringSlice
+	return zoneStringSlice, nil
 }
 
 // GetRegions -
-func GetRegions(defaultContext context.Context, project string) []string {
+func GetRegions(config config.Config) ([]string, error) {
+	project := config.Project
 	log.Println("[Info] Retrieving regions for project:", project)
-	serviceClient, err := compute.NewService(defaultContext)
+	serviceClient, err := compute.NewService(config.Context, clientOptions(config, "compute")...)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	regionListCall := serviceClient.Regions.List(project)
-	regionList, err := regionListCall.Do()
+	regionStringSlice := []string{}
+	err = serviceClient.Regions.List(project).Pages(config.Context, func(regionList *compute.RegionList) error {
+		for _, region := range regionList.Items {
+			regionNameSplit := strings.Split(region.Name, "/")
+			regionStringSlice = append(regionStringSlice, regionNameSplit[len(regionNameSplit)-1])
+		}
+		return nil
+	})
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	return regionStringSlice, nil
+}
 
-	regionStringSlice := []string{}
-	for _, region := range regionList.Items {
-		regionNameSplit := strings.Split(region.Name, "/")
-		regionStringSlice = append(regionStringSlice, regionNameSplit[len(regionNameSplit)-1])
+// aggregatedScope - splits the key of a compute aggregated list, eg. zones/europe-west2-a, into its kind and location
+func aggregatedScope(key string) (string, string) {
+	kind, location, _ := strings.Cut(key, "/")
+	return kind, location
+}
+
+// selectLocations - replaces the zone and region patterns of the config with the matching locations of the project.
+// Zones are restricted to the selected regions if only regions are given, and regions to the regions of the selected
+// zones if only zones are given. A pattern which matches no location of the project is an error.
+func selectLocations(config config.Config) (config.Config, error) {
+	if len(config.Zones) == 0 && len(config.Regions) == 0 {
+		return config, nil
+	}
+	zones, err := GetZones(config)
+	if err != nil {
+		return config, fmt.Errorf("unable to list zones: %v", err)
+	}
+	regions, err := GetRegions(config)
+	if err != nil {
+		return config, fmt.Errorf("unable to list regions: %v", err)
+	}
+
+	selectedRegions, err := matchLocations("region", config.Regions, regions)
+	if err != nil {
+		return config, err
+	}
+	selectedZones, err := matchLocations("zone", config.Zones, zones)
+	if err != nil {
+		return config, err
+	}
+	if len(config.Zones) == 0 {
+		for _, zone := range zones {
+			if helpers.SliceContains(selectedRegions, zoneRegion(zone)) {
+				selectedZones = append(selectedZones, zone)
+			}
+		}
+	}
+	if len(config.Regions) == 0 {
+		for _, zone := range selectedZones {
+			if !helpers.SliceContains(selectedRegions, zoneRegion(zone)) {
+				selectedRegions = append(selectedRegions, zoneRegion(zone))
+			}
+		}
+	}
+	if len(selectedZones) == 0 || len(selectedRegions) == 0 {
+		// No locations would select all of them
+		return config, fmt.Errorf("the selected regions %v have no zones in project %v", selectedRegions, config.Project)
+	}
+	log.Printf("[Info] Restricted to regions %v and zones %v [project: %v]", strings.Join(selectedRegions, ", "), strings.Join(selectedZones, ", "), config.Project)
+	config.Zones = selectedZones
+	config.Regions = selectedRegions
+	return config, nil
+}
+
+// matchLocations - locations matching any of the patterns, every pattern has to match at least one of them
+func matchLocations(kind string, patterns, locations []string) ([]string, error) {
+	matched := []string{}
+	for _, pattern := range patterns {
+		found := false
+		for _, location := range locations {
+			if selected, _ := path.Match(pattern, location); selected {
+				found = true
+				if !helpers.SliceContains(matched, location) {
+					matched = append(matched, location)
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%v %v matches none of: %v", kind, pattern, strings.Join(locations, ", "))
+		}
+	}
+	sort.Strings(matched)
+	return matched, nil
+}
+
+// zoneRegion - region of a zone, eg. europe-west2 for europe-west2-a
+func zoneRegion(zone string) string {
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		return zone[:i]
+	}
+	return zone
+}
+
+// locationSelected - whether items in a zone or region are part of the run, no locations selects all of them
+func locationSelected(locations []string, location string) bool {
+	return len(locations) == 0 || helpers.SliceContains(locations, location)
+}
+
+// itemLocationSelected - whether an item of a resource which is not listed by compute zone or region, eg. a GKE
+// cluster, is part of the run. Its location may be a zone, a region or a multi-region, which is never selected by a
+// restriction.
+func itemLocationSelected(config config.Config, location string) bool {
+	if len(config.Zones) == 0 && len(config.Regions) == 0 {
+		return true
 	}
-	return regionStringSlice
+	location = strings.ToLower(location)
+	return helpers.SliceContains(config.Regions, location) || helpers.SliceContains(config.Zones, location)
 }
 
 func extractGKESelfLink(input string) string {
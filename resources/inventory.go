@@ -0,0 +1,213 @@
+package resources
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ianbrown78/gcp-nuke/config"
+)
+
+// Formats and sort orders of an inventory
+const (
+	InventoryText = "text"
+	InventoryJSON = "json"
+	InventoryCSV  = "csv"
+
+	SortType     = "type"
+	SortName     = "name"
+	SortLocation = "location"
+	SortCreated  = "created"
+	SortSize     = "size"
+)
+
+// InventoryItem - an item of a project as listed, whether a run would delete it or not
+type InventoryItem struct {
+	Project  string `json:"project"`
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Location string `json:"location"`
+	// Created - RFC 3339 in UTC, empty if unknown
+	Created   string            `json:"created,omitempty"`
+	Labels    map[string]string `json:"labels"`
+	Protected bool              `json:"protected"`
+	// SizeBytes - estimated storage of the item, 0 if unknown
+	SizeBytes int64 `json:"sizeBytes"`
+}
+
+// ListInventory - lists the selected resource types of every project, without the filters of the config file. Types
+// which cannot be listed are left out and returned as error, with the items of every other type.
+func ListInventory(configs []config.Config) ([]InventoryItem, error) {
+	items := []InventoryItem{}
+	failed := []string{}
+	for _, projectConfig := range configs {
+		if err := checkTypeNames(append(append([]string{}, projectConfig.IncludeTypes...), projectConfig.ExcludeTypes...)); err != nil {
+			return nil, err
+		}
+		projectConfig.Filters = nil
+		resourceMap, err := GetResourceMap(projectConfig)
+		if err != nil {
+			return nil, err
+		}
+		runErrs := newRunErrors(projectConfig.Project)
+		listResources(resourceMap, runErrs)
+		if err := runErrs.errorOrNil(); err != nil {
+			failed = append(failed, err.Error())
+		}
+
+		for name, resource := range resourceMap {
+			properties := resource.Properties()
+			for _, item := range resource.ToSlice() {
+				labels := properties[item].labels
+				if labels == nil {
+					labels = map[string]string{}
+				}
+				// An update time is not shown as the creation time, eg. of a redeployed function
+				created := ""
+				if !properties[item].created.IsZero() && !properties[item].createdIsUpdate {
+					created = properties[item].created.UTC().Format(time.RFC3339)
+				}
+				items = append(items, InventoryItem{
+					Project:   projectConfig.Project,
+					Type:      name,
+					Name:      item,
+					Location:  properties[item].location(),
+					Created:   created,
+					Labels:    labels,
+					Protected: properties[item].protected,
+					SizeBytes: properties[item].sizeBytes,
+				})
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return items, errors.New(strings.Join(failed, "\n"))
+	}
+	return items, nil
+}
+
+// CheckInventoryOptions - validates the format and sort order of an inventory
+func CheckInventoryOptions(format, sortBy string) error {
+	switch format {
+	case InventoryText, InventoryJSON, InventoryCSV:
+	default:
+		return fmt.Errorf("unknown format %v, expected %v, %v or %v", format, InventoryText, InventoryJSON, InventoryCSV)
+	}
+	switch sortBy {
+	case SortType, SortName, SortLocation, SortCreated, SortSize:
+	default:
+		return fmt.Errorf("unknown sort order %v, expected %v, %v, %v, %v or %v", sortBy, SortType, SortName, SortLocation, SortCreated, SortSize)
+	}
+	return nil
+}
+
+// sortInventory - by project, type and name, or first by sortBy. Oldest and largest items come first, items of
+// unknown age or size last.
+func sortInventory(items []InventoryItem, sortBy string) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		switch {
+		case sortBy == SortName && a.Name != b.Name:
+			return a.Name < b.Name
+		case sortBy == SortLocation && a.Location != b.Location:
+			return a.Location < b.Location
+		case sortBy == SortCreated && a.Created != b.Created:
+			// RFC 3339 times in UTC sort as strings
+			return b.Created == "" || (a.Created != "" && a.Created < b.Created)
+		case sortBy == SortSize && a.SizeBytes != b.SizeBytes:
+			return a.SizeBytes > b.SizeBytes
+		case a.Project != b.Project:
+			return a.Project < b.Project
+		case a.Type != b.Type:
+			return a.Type < b.Type
+		}
+		return a.Name < b.Name
+	})
+}
+
+// WriteInventory - writes the items sorted by sortBy as a text table, JSON or CSV
+func WriteInventory(w io.Writer, items []InventoryItem, format, sortBy string) error {
+	if err := CheckInventoryOptions(format, sortBy); err != nil {
+		return err
+	}
+	sortInventory(items, sortBy)
+
+	switch format {
+	case InventoryJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(items)
+	case InventoryCSV:
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"project", "type", "name", "location", "created", "labels", "protected", "size_bytes"})
+		for _, item := range items {
+			writer.Write([]string{item.Project, item.Type, item.Name, item.Location, item.Created, formatLabels(item.Labels, ";"),
+				strconv.FormatBool(item.Protected), strconv.FormatInt(item.SizeBytes, 10)})
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+
+	// The project is only shown if there are several
+	projects := make(map[string]bool)
+	for _, item := range items {
+		projects[item.Project] = true
+	}
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	columns := []string{"TYPE", "NAME", "LOCATION", "CREATED", "LABELS", "PROTECTED", "SIZE"}
+	if len(projects) > 1 {
+		columns = append([]string{"PROJECT"}, columns...)
+	}
+	fmt.Fprintln(table, strings.Join(columns, "\t"))
+	for _, item := range items {
+		created := item.Created
+		if created == "" {
+			created = "-"
+		}
+		labels := formatLabels(item.Labels, ",")
+		if labels == "" {
+			labels = "-"
+		}
+		row := []string{item.Type, item.Name, item.Location, created, labels, strconv.FormatBool(item.Protected), formatSize(item.SizeBytes)}
+		if len(projects) > 1 {
+			row = append([]string{item.Project}, row...)
+		}
+		fmt.Fprintln(table, strings.Join(row, "\t"))
+	}
+	return table.Flush()
+}
+
+// formatLabels - key=value pairs sorted by key
+func formatLabels(labels map[string]string, separator string) string {
+	pairs := []string{}
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, separator)
+}
+
+// formatSize - size in binary units, - if unknown
+func formatSize(sizeBytes int64) string {
+	if sizeBytes <= 0 {
+		return "-"
+	}
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	size := float64(sizeBytes)
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%v B", sizeBytes)
+	}
+	return fmt.Sprintf("%.1f %v", size, units[unit])
+}
@@ -0,0 +1,106 @@
+package resources
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ianbrown78/gcp-nuke/config"
+	"github.com/ianbrown78/gcp-nuke/internal/fakegcp"
+)
+
+func TestListInventory(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	server.Seed(zonePath+"/disks", "disk-2", map[string]interface{}{
+		"name":              "disk-2",
+		"sizeGb":            "100",
+		"labels":            map[string]interface{}{"env": "dev", "team": "data"},
+		"creationTimestamp": "2019-06-01T00:00:00.000-00:00",
+	})
+	server.Seed(zonePath+"/disks", "disk-3", map[string]interface{}{"name": "disk-3", "sizeGb": "10"})
+
+	runConfig := testConfig(server)
+	runConfig.IncludeTypes = []string{"ComputeDisks", "SqlInstances"}
+	// Filters of the config file are not applied to an inventory
+	runConfig.Filters = map[string][]config.Filter{"ComputeDisks": {{Value: "disk-1"}}}
+	items, err := ListInventory([]config.Config{runConfig})
+	if err != nil {
+		t.Fatalf("listing failed: %v", err)
+	}
+	for _, request := range server.Requests() {
+		if !strings.HasPrefix(request, "GET ") {
+			t.Errorf("inventory changed something: %v", request)
+		}
+	}
+
+	output := &bytes.Buffer{}
+	if err := WriteInventory(output, items, InventoryJSON, SortSize); err != nil {
+		t.Fatalf("writing JSON failed: %v", err)
+	}
+	listed := []InventoryItem{}
+	if err := json.Unmarshal(output.Bytes(), &listed); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	names := []string{}
+	for _, item := range listed {
+		names = append(names, item.Name)
+	}
+	// Largest first, unknown sizes last
+	if !reflect.DeepEqual(names, []string{"disk-2", "disk-3", "disk-1", "sql-1"}) {
+		t.Errorf("unexpected order by size: %v", names)
+	}
+	expected := InventoryItem{
+		Project:   testProject,
+		Type:      "ComputeDisks",
+		Name:      "disk-2",
+		Location:  testZone,
+		Created:   "2019-06-01T00:00:00Z",
+		Labels:    map[string]string{"env": "dev", "team": "data"},
+		SizeBytes: 100 * gibibyte,
+	}
+	if !reflect.DeepEqual(listed[0], expected) {
+		t.Errorf("got %+v, expected %+v", listed[0], expected)
+	}
+	if !listed[3].Protected {
+		t.Errorf("expected the SQL instance to be protected")
+	}
+
+	output.Reset()
+	if err := WriteInventory(output, items, InventoryCSV, SortCreated); err != nil {
+		t.Fatalf("writing CSV failed: %v", err)
+	}
+	records, err := csv.NewReader(output).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	if len(records) != 5 || records[1][2] != "disk-2" || records[1][5] != "env=dev;team=data" || records[1][7] != "107374182400" {
+		t.Errorf("unexpected CSV sorted by creation: %v", records)
+	}
+
+	output.Reset()
+	if err := WriteInventory(output, items, InventoryText, SortName); err != nil {
+		t.Fatalf("writing text failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[0], "TYPE") || !strings.Contains(lines[2], "100.0 GiB") {
+		t.Errorf("unexpected table:\n%v", output.String())
+	}
+	if err := WriteInventory(output, items, "yaml", SortName); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+
+	// Functions only report their last update, which is not their creation time
+	runConfig.IncludeTypes = []string{"FunctionsInstances"}
+	items, err = ListInventory([]config.Config{runConfig})
+	if err != nil {
+		t.Fatalf("listing failed: %v", err)
+	}
+	if len(items) != 1 || items[0].Created != "" {
+		t.Errorf("expected a function without creation time, got %+v", items)
+	}
+}
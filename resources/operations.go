@@ -0,0 +1,267 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ianbrown78/gcp-nuke/config"
+	"google.golang.org/api/cloudfunctions/v2"
+	"google.golang.org/api/cloudresourcemanager/v3"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/container/v1"
+	"google.golang.org/api/sqladmin/v1beta4"
+)
+
+const (
+	minOperationBackoff = 100 * time.Millisecond
+	maxOperationBackoff = 30 * time.Second
+)
+
+// operationPoller - fetches the state of a long running operation once. Returns whether it is done,
+// and an *operationError if it finished with an error payload.
+type operationPoller func(ctx context.Context) (bool, error)
+
+// operationRef - identifies a long running operation, so it can be polled again by a resumed run
+type operationRef struct {
+	// Service - API of the operation, as used for client options, eg. compute
+	Service string `json:"service"`
+	Name    string `json:"name"`
+	Zone    string `json:"zone,omitempty"`
+	Region  string `json:"region,omitempty"`
+}
+
+// longRunningOperation - a started operation and how to poll it
+type longRunningOperation struct {
+	ref  operationRef
+	poll operationPoller
+}
+
+// operationError - error payload of a finished long running operation
+type operationError struct {
+	operation string
+	// reasons - machine readable error codes, eg. RESOURCE_IN_USE_BY_ANOTHER_RESOURCE or FAILED_PRECONDITION
+	reasons  []string
+	messages []string
+}
+
+// Error -
+func (e *operationError) Error() string {
+	return fmt.Sprintf("operation %v failed: %v (%v)", e.operation, strings.Join(e.messages, "; "), strings.Join(e.reasons, ", "))
+}
+
+// rpcCodeNames - google.rpc.Code values as returned in the Status of google.longrunning operations
+var rpcCodeNames = map[int64]string{
+	1:  "CANCELLED",
+	3:  "INVALID_ARGUMENT",
+	4:  "DEADLINE_EXCEEDED",
+	5:  "NOT_FOUND",
+	6:  "ALREADY_EXISTS",
+	7:  "PERMISSION_DENIED",
+	8:  "RESOURCE_EXHAUSTED",
+	9:  "FAILED_PRECONDITION",
+	10: "ABORTED",
+	13: "INTERNAL",
+	14: "UNAVAILABLE",
+}
+
+func rpcStatusError(operation string, code int64, message string) *operationError {
+	reason, known := rpcCodeNames[code]
+	if !known {
+		reason = fmt.Sprintf("code %v", code)
+	}
+	return &operationError{operation: operation, reasons: []string{reason}, messages: []string{message}}
+}
+
+// waitForOperation - polls an operation until it is done, backing off exponentially from the poll time.
+// Gives up once the config timeout has passed, description is used for logging, eg. "deletion of x [type: y]".
+// The operation is kept in the checkpoint of the run until it is seen to finish.
+func waitForOperation(config config.Config, description string, operation longRunningOperation) error {
+	ctx, cancel := context.WithTimeout(config.Context, time.Duration(config.Timeout)*time.Second)
+	defer cancel()
+
+	runCheckpoint := checkpointFrom(config.Context)
+	if runCheckpoint != nil {
+		runCheckpoint.addOperation(operation.ref, description)
+	}
+
+	delay := time.Duration(config.PollTime) * time.Second
+	if delay < minOperationBackoff {
+		delay = minOperationBackoff
+	}
+	start := time.Now()
+	for {
+		done, err := operation.poll(ctx)
+		if ctx.Err() != nil {
+			return waitAborted(config, description)
+		}
+		if done && runCheckpoint != nil {
+			runCheckpoint.removeOperation(operation.ref)
+		}
+		if err != nil || done {
+			return err
+		}
+
+		log.Printf("[Info] Waiting for %v (%v seconds)", description, int(time.Since(start).Seconds()))
+		select {
+		case <-ctx.Done():
+			return waitAborted(config, description)
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxOperationBackoff {
+			delay = maxOperationBackoff
+		}
+	}
+}
+
+// waitAborted - why waiting for an operation stopped before it was done: the run was cancelled, eg. by a second
+// Ctrl+C, or the timeout passed
+func waitAborted(config config.Config, description string) error {
+	if config.Context.Err() != nil {
+		return fmt.Errorf("[Error] Interrupted while waiting for %v, the run was cancelled", description)
+	}
+	return fmt.Errorf("[Error] Timed out waiting for %v (%v seconds)", description, config.Timeout)
+}
+
+// computeOperation - zonal, regional or global Compute Engine operation, depending on its scope
+func computeOperation(serviceClient *compute.Service, project string, operation *compute.Operation) longRunningOperation {
+	ref := operationRef{Service: "compute", Name: operation.Name}
+	switch {
+	case operation.Zone != "":
+		ref.Zone = path.Base(operation.Zone)
+	case operation.Region != "":
+		ref.Region = path.Base(operation.Region)
+	}
+	return longRunningOperation{ref: ref, poll: func(ctx context.Context) (bool, error) {
+		var current *compute.Operation
+		var err error
+		switch {
+		case ref.Zone != "":
+			current, err = serviceClient.ZoneOperations.Get(project, ref.Zone, ref.Name).Context(ctx).Do()
+		case ref.Region != "":
+			current, err = serviceClient.RegionOperations.Get(project, ref.Region, ref.Name).Context(ctx).Do()
+		default:
+			current, err = serviceClient.GlobalOperations.Get(project, ref.Name).Context(ctx).Do()
+		}
+		if err != nil || current.Status != "DONE" {
+			return false, err
+		}
+		if current.Error != nil && len(current.Error.Errors) > 0 {
+			opErr := &operationError{operation: current.Name}
+			for _, item := range current.Error.Errors {
+				opErr.reasons = append(opErr.reasons, item.Code)
+				opErr.messages = append(opErr.messages, item.Message)
+			}
+			return true, opErr
+		}
+		return true, nil
+	}}
+}
+
+// sqlOperation - Cloud SQL Admin operation
+func sqlOperation(serviceClient *sqladmin.Service, project string, operation *sqladmin.Operation) longRunningOperation {
+	ref := operationRef{Service: "sqladmin", Name: operation.Name}
+	return longRunningOperation{ref: ref, poll: func(ctx context.Context) (bool, error) {
+		current, err := serviceClient.Operations.Get(project, ref.Name).Context(ctx).Do()
+		if err != nil || current.Status != "DONE" {
+			return false, err
+		}
+		if current.Error != nil && len(current.Error.Errors) > 0 {
+			opErr := &operationError{operation: current.Name}
+			for _, item := range current.Error.Errors {
+				opErr.reasons = append(opErr.reasons, item.Code)
+				opErr.messages = append(opErr.messages, item.Message)
+			}
+			return true, opErr
+		}
+		return true, nil
+	}}
+}
+
+// containerOperation - GKE operation, addressed through its self link as the name alone is not unique
+func containerOperation(serviceClient *container.Service, operation *container.Operation) longRunningOperation {
+	ref := operationRef{Service: "container", Name: extractGKESelfLink(operation.SelfLink)}
+	return longRunningOperation{ref: ref, poll: func(ctx context.Context) (bool, error) {
+		current, err := serviceClient.Projects.Locations.Operations.Get(ref.Name).Context(ctx).Do()
+		if err != nil || current.Status != "DONE" {
+			return false, err
+		}
+		if current.Error != nil && current.Error.Code != 0 {
+			return true, rpcStatusError(ref.Name, current.Error.Code, current.Error.Message)
+		}
+		return true, nil
+	}}
+}
+
+// functionsOperation - Cloud Functions long running operation
+func functionsOperation(serviceClient *cloudfunctions.Service, operation *cloudfunctions.Operation) longRunningOperation {
+	ref := operationRef{Service: "cloudfunctions", Name: operation.Name}
+	return longRunningOperation{ref: ref, poll: func(ctx context.Context) (bool, error) {
+		current, err := serviceClient.Projects.Locations.Operations.Get(ref.Name).Context(ctx).Do()
+		if err != nil || !current.Done {
+			return false, err
+		}
+		if current.Error != nil {
+			return true, rpcStatusError(current.Name, current.Error.Code, current.Error.Message)
+		}
+		return true, nil
+	}}
+}
+
+// resourceManagerOperation - Resource Manager long running operation
+func resourceManagerOperation(serviceClient *cloudresourcemanager.Service, operation *cloudresourcemanager.Operation) longRunningOperation {
+	ref := operationRef{Service: "cloudresourcemanager", Name: operation.Name}
+	return longRunningOperation{ref: ref, poll: func(ctx context.Context) (bool, error) {
+		current, err := serviceClient.Operations.Get(ref.Name).Context(ctx).Do()
+		if err != nil || !current.Done {
+			return false, err
+		}
+		if current.Error != nil {
+			return true, rpcStatusError(current.Name, current.Error.Code, current.Error.Message)
+		}
+		return true, nil
+	}}
+}
+
+// resumedOperation - operation recorded in a checkpoint by an earlier run, with a new client for its service
+func resumedOperation(config config.Config, ref operationRef) (longRunningOperation, error) {
+	ctx := config.Context
+	options := clientOptions(config, ref.Service)
+	switch ref.Service {
+	case "compute":
+		serviceClient, err := compute.NewService(ctx, options...)
+		if err != nil {
+			return longRunningOperation{}, err
+		}
+		return computeOperation(serviceClient, config.Project, &compute.Operation{Name: ref.Name, Zone: ref.Zone, Region: ref.Region}), nil
+	case "sqladmin":
+		serviceClient, err := sqladmin.NewService(ctx, options...)
+		if err != nil {
+			return longRunningOperation{}, err
+		}
+		return sqlOperation(serviceClient, config.Project, &sqladmin.Operation{Name: ref.Name}), nil
+	case "container":
+		serviceClient, err := container.NewService(ctx, options...)
+		if err != nil {
+			return longRunningOperation{}, err
+		}
+		return containerOperation(serviceClient, &container.Operation{SelfLink: ref.Name}), nil
+	case "cloudfunctions":
+		serviceClient, err := cloudfunctions.NewService(ctx, options...)
+		if err != nil {
+			return longRunningOperation{}, err
+		}
+		return functionsOperation(serviceClient, &cloudfunctions.Operation{Name: ref.Name}), nil
+	case "cloudresourcemanager":
+		serviceClient, err := cloudresourcemanager.NewService(ctx, options...)
+		if err != nil {
+			return longRunningOperation{}, err
+		}
+		return resourceManagerOperation(serviceClient, &cloudresourcemanager.Operation{Name: ref.Name}), nil
+	}
+	return longRunningOperation{}, fmt.Errorf("unknown service %v of operation %v", ref.Service, ref.Name)
+}
@@ -0,0 +1,60 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ianbrown78/gcp-nuke/config"
+)
+
+func TestWaitForOperation(t *testing.T) {
+	polls := 0
+	err := waitForOperation(config.Config{Context: context.Background(), Timeout: 10}, "test operation", longRunningOperation{poll: func(ctx context.Context) (bool, error) {
+		polls++
+		return polls == 3, nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if polls != 3 {
+		t.Errorf("expected 3 polls, got %v", polls)
+	}
+}
+
+func TestWaitForOperationTimeout(t *testing.T) {
+	err := waitForOperation(config.Config{Context: context.Background(), Timeout: 1}, "test operation", longRunningOperation{poll: func(ctx context.Context) (bool, error) {
+		return false, nil
+	}})
+	if err == nil || !strings.Contains(err.Error(), "Timed out waiting for test operation") {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+}
+
+func TestWaitForOperationCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := waitForOperation(config.Config{Context: ctx, Timeout: 10}, "test operation", longRunningOperation{poll: func(ctx context.Context) (bool, error) {
+		return false, ctx.Err()
+	}})
+	if err == nil || !strings.Contains(err.Error(), "Interrupted while waiting for test operation") {
+		t.Fatalf("expected the wait to be reported as interrupted, got %v", err)
+	}
+}
+
+func TestWaitForOperationError(t *testing.T) {
+	err := waitForOperation(config.Config{Context: context.Background(), Timeout: 10}, "test operation", longRunningOperation{poll: func(ctx context.Context) (bool, error) {
+		return true, rpcStatusError("operation-1", 9, "cluster is being upgraded")
+	}})
+	var opErr *operationError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("expected an operation error, got %v", err)
+	}
+	if class := classifyAPIError(err); class != apiErrorPrecondition {
+		t.Errorf("expected the error to be classified as %v, got %v", apiErrorPrecondition, class)
+	}
+	if !retryableDeletionError(err) {
+		t.Errorf("expected a failed precondition to be retryable")
+	}
+}
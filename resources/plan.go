@@ -0,0 +1,174 @@
+package resources
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ianbrown78/gcp-nuke/config"
+)
+
+// Plan - the items of a project to delete, written by the plan command and deleted by apply
+type Plan struct {
+	Project string    `json:"project"`
+	Created time.Time `json:"created"`
+	// Resources - items by resource type
+	Resources map[string][]PlanItem `json:"resources"`
+	// Hash - SHA-256 of the plan without the hash, to detect changes after it was reviewed
+	Hash string `json:"hash"`
+}
+
+// PlanItem - an item of the plan, identified by its name and creation time. An item of the same name created after
+// the plan was made is not part of it.
+type PlanItem struct {
+	Name string `json:"name"`
+	// Created - RFC 3339 creation time in UTC, empty if unknown
+	Created string `json:"created,omitempty"`
+}
+
+// planIdentity - creation time of an item as recorded in a plan, empty if unknown
+func planIdentity(properties DefaultResourceProperties) string {
+	if properties.created.IsZero() {
+		return ""
+	}
+	return properties.created.UTC().Format(time.RFC3339Nano)
+}
+
+// contentHash - hash of everything but the hash itself, map keys are sorted by encoding/json
+func (p Plan) contentHash() (string, error) {
+	p.Hash = ""
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ResourceTypes - sorted resource types which have items in the plan
+func (p *Plan) ResourceTypes() []string {
+	names := []string{}
+	for name, items := range p.Resources {
+		if len(items) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Items - creation time of every item by resource type and name, as used by config.Plan
+func (p *Plan) Items() map[string]map[string]string {
+	items := make(map[string]map[string]string)
+	for name, planItems := range p.Resources {
+		items[name] = make(map[string]string)
+		for _, item := range planItems {
+			items[name][item.Name] = item.Created
+		}
+	}
+	return items
+}
+
+// WritePlan - lists the selected resources of the project like a dry run, and writes the items which would be
+// deleted to path. No plan is written if a resource type cannot be listed.
+func WritePlan(config config.Config, path string) error {
+	resourceMap, err := GetResourceMap(config)
+	if err != nil {
+		return err
+	}
+	runErrs := newRunErrors(config.Project)
+	listResources(resourceMap, runErrs)
+	printInventory(resourceMap, config)
+	if err := runErrs.errorOrNil(); err != nil {
+		return err
+	}
+
+	plan := Plan{
+		Project:   config.Project,
+		Created:   time.Now().UTC().Truncate(time.Second),
+		Resources: make(map[string][]PlanItem),
+	}
+	for name, resource := range resourceMap {
+		properties := resource.Properties()
+		plan.Resources[name] = []PlanItem{}
+		for _, item := range resource.ToSlice() {
+			plan.Resources[name] = append(plan.Resources[name], PlanItem{Name: item, Created: planIdentity(properties[item])})
+		}
+	}
+	plan.Hash, err = plan.contentHash()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("unable to write plan file: %v", err)
+	}
+	log.Printf("[Info] Plan for project %v written to %v (hash: %v)", config.Project, path, plan.Hash)
+	return nil
+}
+
+// ReadPlan - reads a plan file, which has to be unchanged and made for project
+func ReadPlan(path, project string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read plan file: %v", err)
+	}
+	plan := &Plan{}
+	if err := json.Unmarshal(data, plan); err != nil {
+		return nil, fmt.Errorf("unable to parse plan file %v: %v", path, err)
+	}
+	hash, err := plan.contentHash()
+	if err != nil {
+		return nil, err
+	}
+	if hash != plan.Hash {
+		return nil, fmt.Errorf("plan file %v was modified after it was written, its hash does not match", path)
+	}
+	if plan.Project != project {
+		return nil, fmt.Errorf("plan file %v was made for project %v, not %v", path, plan.Project, project)
+	}
+	return plan, nil
+}
+
+// checkPlan - warns about items of the plan which no longer exist, or are now kept by a filter. Items which
+// appeared since the plan was made, including ones recreated under a planned name, are kept as filtered.
+func checkPlan(resourceMap map[string]Resource, config config.Config) {
+	names := []string{}
+	for name := range config.Plan {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		resource, selected := resourceMap[name]
+		if !selected {
+			continue
+		}
+		listed := make(map[string]bool)
+		for _, item := range resource.ToSlice() {
+			listed[item] = true
+		}
+		filtered := resource.Filtered()
+		items := []string{}
+		for item := range config.Plan[name] {
+			items = append(items, item)
+		}
+		sort.Strings(items)
+		for _, item := range items {
+			switch {
+			case listed[item]:
+			case filtered[item] != "":
+				log.Printf("[Warning] %v item %v of the plan is kept, %v [project: %v]", name, item, filtered[item], config.Project)
+			default:
+				log.Printf("[Warning] %v item %v of the plan no longer exists [project: %v]", name, item, config.Project)
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package resources
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ianbrown78/gcp-nuke/helpers"
+)
+
+// deletionProgress - tracks the deletion of the listed items, to report what was done when a run is interrupted
+type deletionProgress struct {
+	mutex     sync.Mutex
+	resources map[string]Resource
+	// listed - items per resource type at the start of the deletion
+	listed  map[string][]string
+	running map[string]bool
+}
+
+func newDeletionProgress(resourceMap map[string]Resource) *deletionProgress {
+	return &deletionProgress{
+		resources: resourceMap,
+		listed:    make(map[string][]string),
+		running:   make(map[string]bool),
+	}
+}
+
+// snapshot - records the currently listed items as the starting point
+func (p *deletionProgress) snapshot() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for name, resource := range p.resources {
+		p.listed[name] = resource.ToSlice()
+	}
+}
+
+func (p *deletionProgress) started(name string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.running[name] = true
+}
+
+func (p *deletionProgress) finished(name string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.running[name] = false
+}
+
+// summary - listed items per resource type which are deleted, being deleted, or were not touched (yet)
+func (p *deletionProgress) summary() (deleted, inFlight, untouched map[string][]string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	deleted = make(map[string][]string)
+	inFlight = make(map[string][]string)
+	untouched = make(map[string][]string)
+	for name, items := range p.listed {
+		remaining := p.resources[name].ToSlice()
+		for _, item := range items {
+			switch {
+			case !helpers.SliceContains(remaining, item):
+				deleted[name] = append(deleted[name], item)
+			case p.running[name]:
+				inFlight[name] = append(inFlight[name], item)
+			default:
+				untouched[name] = append(untouched[name], item)
+			}
+		}
+	}
+	return deleted, inFlight, untouched
+}
+
+// print - logs the summary
+func (p *deletionProgress) print(project string) {
+	deleted, inFlight, untouched := p.summary()
+	log.Printf("-- Progress of project %v at interruption --", project)
+	for _, category := range []struct {
+		label string
+		items map[string][]string
+	}{
+		{"Deleted", deleted},
+		{"In flight", inFlight},
+		{"Untouched", untouched},
+	} {
+		if len(category.items) == 0 {
+			log.Printf("[%v] none", category.label)
+			continue
+		}
+		names := []string{}
+		for name := range category.items {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			log.Printf("[%v] %v: %v", category.label, name, strings.Join(category.items[name], ", "))
+		}
+	}
+}
+
+// runningProjects - projects which are being nuked, so a second interrupt can abort them and report their progress
+type runningProjects struct {
+	mutex    sync.Mutex
+	projects map[string]runningProject
+}
+
+type runningProject struct {
+	progress *deletionProgress
+	// cancel - aborts every API call and operation wait of the project
+	cancel context.CancelFunc
+}
+
+func newRunningProjects() *runningProjects {
+	return &runningProjects{projects: make(map[string]runningProject)}
+}
+
+func (r *runningProjects) add(project string, progress *deletionProgress, cancel context.CancelFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.projects[project] = runningProject{progress: progress, cancel: cancel}
+}
+
+func (r *runningProjects) remove(project string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.projects, project)
+}
+
+// terminate - aborts every running project and prints its progress
+func (r *runningProjects) terminate() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	projects := []string{}
+	for project := range r.projects {
+		projects = append(projects, project)
+	}
+	sort.Strings(projects)
+	for _, project := range projects {
+		r.projects[project].cancel()
+		r.projects[project].progress.print(project)
+	}
+}
@@ -0,0 +1,155 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/ianbrown78/gcp-nuke/config"
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+// projectLiens - liens on the project, any of them prevents its deletion
+func projectLiens(config config.Config, client *cloudresourcemanager.Service) ([]*cloudresourcemanager.Lien, error) {
+	liens := []*cloudresourcemanager.Lien{}
+	err := client.Liens.List().Parent("projects/"+config.Project).Pages(config.Context, func(response *cloudresourcemanager.ListLiensResponse) error {
+		liens = append(liens, response.Liens...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the liens of project %v: %v", config.Project, err)
+	}
+	for _, lien := range liens {
+		log.Printf("[Info] Lien %v on project %v created by %v: %v [restrictions: %v]", lien.Name, config.Project, lien.Origin, lien.Reason, lien.Restrictions)
+	}
+	return liens, nil
+}
+
+// dryRunProjectDeletion - reports the liens on the project, and whether they would keep it
+func dryRunProjectDeletion(config config.Config, report *runReport) error {
+	client, err := cloudresourcemanager.NewService(config.Context, clientOptions(config, "cloudresourcemanager")...)
+	if err != nil {
+		return err
+	}
+	liens, err := projectLiens(config, client)
+	if err != nil {
+		return err
+	}
+	if len(liens) > 0 && !config.RemoveLiens {
+		report.recordLiens(liens, actionBlocking, nil)
+		log.Printf("[Dryrun] Project %v would be kept, it has %v lien(s). Remove them with --remove-liens", config.Project, len(liens))
+		return nil
+	}
+	report.recordLiens(liens, actionWouldDelete, nil)
+	log.Printf("[Dryrun] Project %v would be deleted after its resources and %v lien(s)", config.Project, len(liens))
+	report.recordProject(actionWouldDelete, nil)
+	return nil
+}
+
+// deleteProject - deletes the project itself after its own confirmation, unless the run was stopped. Liens are removed
+// first with config.RemoveLiens, and keep the project otherwise. The deletion is waited on for config.ProjectTimeout
+// seconds.
+func deleteProject(config config.Config, stopped context.Context, report *runReport) error {
+	client, err := cloudresourcemanager.NewService(config.Context, clientOptions(config, "cloudresourcemanager")...)
+	if err != nil {
+		return err
+	}
+
+	liens, err := projectLiens(config, client)
+	if err != nil {
+		return err
+	}
+	if len(liens) > 0 && !config.RemoveLiens {
+		report.recordLiens(liens, actionBlocking, nil)
+		return fmt.Errorf("project %v has %v lien(s), it cannot be deleted until they are removed, eg. with --remove-liens", config.Project, len(liens))
+	}
+
+	err = confirmNuke(config, fmt.Sprintf("[Confirm] Project %v itself will be deleted with its %v lien(s), including the resources kept by filters. Do you really want to delete it?", config.Project, len(liens)))
+	if err != nil {
+		return err
+	}
+	if stopped.Err() != nil {
+		return fmt.Errorf("interrupted before project %v was deleted", config.Project)
+	}
+
+	for _, lien := range liens {
+		if _, err := client.Liens.Delete(lien.Name).Context(config.Context).Do(); err != nil {
+			report.recordLiens([]*cloudresourcemanager.Lien{lien}, actionFailed, err)
+			return fmt.Errorf("unable to remove lien %v created by %v: %v", lien.Name, lien.Origin, err)
+		}
+		log.Printf("[Info] Lien %v created by %v removed [project: %v]", lien.Name, lien.Origin, config.Project)
+		report.recordLiens([]*cloudresourcemanager.Lien{lien}, actionDeleted, nil)
+	}
+
+	operation, err := client.Projects.Delete("projects/" + config.Project).Context(config.Context).Do()
+	if err != nil {
+		return err
+	}
+	projectConfig := config
+	projectConfig.Timeout = config.ProjectTimeout
+	err = waitForOperation(projectConfig, fmt.Sprintf("deletion of project %v", config.Project), resourceManagerOperation(client, operation))
+	if err != nil {
+		return err
+	}
+	log.Printf("[Info] Project %v deleted, it can be restored for 30 days", config.Project)
+	return nil
+}
+
+// RestoreProject - undeletes a project which is pending deletion, and waits for it to be active again
+func RestoreProject(config config.Config) error {
+	client, err := cloudresourcemanager.NewService(config.Context, clientOptions(config, "cloudresourcemanager")...)
+	if err != nil {
+		return err
+	}
+	project, err := client.Projects.Get("projects/" + config.Project).Context(config.Context).Do()
+	if err != nil {
+		return fmt.Errorf("unable to get project %v: %v", config.Project, err)
+	}
+	if project.State != "DELETE_REQUESTED" {
+		return fmt.Errorf("project %v is %v, only projects pending deletion can be restored", config.Project, project.State)
+	}
+
+	operation, err := client.Projects.Undelete("projects/"+config.Project, &cloudresourcemanager.UndeleteProjectRequest{}).Context(config.Context).Do()
+	if err != nil {
+		return err
+	}
+	err = waitForOperation(config, fmt.Sprintf("restore of project %v", config.Project), resourceManagerOperation(client, operation))
+	if err != nil {
+		return err
+	}
+	log.Printf("[Info] Project %v restored, deleted at %v", config.Project, project.DeleteTime)
+	return nil
+}
+
+// DeletedProjects - projects pending deletion below the parents and their nested folders, sorted by id.
+// config is only used for the API client.
+func DeletedProjects(config config.Config, parents []string) ([]*cloudresourcemanager.Project, error) {
+	client, err := cloudresourcemanager.NewService(config.Context, clientOptions(config, "cloudresourcemanager")...)
+	if err != nil {
+		return nil, err
+	}
+	folders, err := nestedFolders(config, client, parents)
+	if err != nil {
+		return nil, err
+	}
+
+	projects := []*cloudresourcemanager.Project{}
+	for _, folder := range folders {
+		err := client.Projects.List().Parent(folder).ShowDeleted(true).Pages(config.Context, func(response *cloudresourcemanager.ListProjectsResponse) error {
+			for _, project := range response.Projects {
+				if project.State == "DELETE_REQUESTED" {
+					projects = append(projects, project)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the projects of %v: %v", folder, err)
+		}
+	}
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].ProjectId < projects[j].ProjectId
+	})
+	return projects, nil
+}
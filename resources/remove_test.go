@@ -0,0 +1,1154 @@
+package resources
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ianbrown78/gcp-nuke/config"
+	"github.com/ianbrown78/gcp-nuke/helpers"
+	"github.com/ianbrown78/gcp-nuke/internal/fakegcp"
+)
+
+const (
+	testProject = "test-project"
+	testZone    = "europe-west2-a"
+	testRegion  = "europe-west2"
+)
+
+var (
+	computePath   = fmt.Sprintf("%v/projects/%v", fakegcp.Compute, testProject)
+	zonePath      = fmt.Sprintf("%v/zones/%v", computePath, testZone)
+	regionPath    = fmt.Sprintf("%v/regions/%v", computePath, testRegion)
+	globalPath    = computePath + "/global"
+	bucketsPath   = fakegcp.Storage + "/b"
+	sqlPath       = fmt.Sprintf("%v/projects/%v/instances", fakegcp.SQLAdmin, testProject)
+	gkePath       = fmt.Sprintf("%v/projects/%v/locations/%v/clusters", fakegcp.Container, testProject, testRegion)
+	datasetPath   = fmt.Sprintf("%v/projects/%v/datasets", fakegcp.BigQuery, testProject)
+	secretsPath   = fmt.Sprintf("%v/projects/%v/secrets", fakegcp.SecretManager, testProject)
+	locationsPath = fmt.Sprintf("%v/projects/%v/locations", fakegcp.CloudFunctions, testProject)
+	functionsPath = fmt.Sprintf("%v/%v/functions", locationsPath, testRegion)
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+func testConfig(server *fakegcp.Server) config.Config {
+	return config.Config{
+		Project:       testProject,
+		Timeout:       30,
+		PollTime:      0,
+		Context:       context.Background(),
+		Force:         true,
+		ForceSleep:    0,
+		Concurrency:   4,
+		ClientOptions: server.ClientOptions(),
+		Endpoints:     server.Endpoints(),
+	}
+}
+
+// seedProject - one item of most resource types, in the shape the APIs return them
+func seedProject(server *fakegcp.Server) {
+	created := map[string]interface{}{"creationTimestamp": "2020-01-01T00:00:00.000-07:00"}
+	withCreated := func(object map[string]interface{}) map[string]interface{} {
+		for key, value := range created {
+			object[key] = value
+		}
+		return object
+	}
+
+	server.Seed(zonePath+"/instances", "vm-1", withCreated(map[string]interface{}{
+		"name":     "vm-1",
+		"metadata": map[string]interface{}{"items": []interface{}{}},
+		"disks":    []interface{}{map[string]interface{}{"deviceName": "boot"}},
+	}))
+	server.Seed(zonePath+"/disks", "disk-1", withCreated(map[string]interface{}{"name": "disk-1"}))
+	server.Seed(regionPath+"/subnetworks", "subnet-1", withCreated(map[string]interface{}{"name": "subnet-1"}))
+	server.Seed(globalPath+"/networks", "net-1", withCreated(map[string]interface{}{"name": "net-1"}))
+	server.Seed(globalPath+"/firewalls", "fw-1", withCreated(map[string]interface{}{"name": "fw-1"}))
+	server.Seed(globalPath+"/instanceTemplates", "template-1", withCreated(map[string]interface{}{"name": "template-1", "properties": map[string]interface{}{}}))
+	server.Seed(bucketsPath, "bucket-1", map[string]interface{}{"name": "bucket-1", "timeCreated": "2020-01-01T00:00:00Z"})
+	server.Seed(bucketsPath+"/bucket-1/o", "object-1", map[string]interface{}{"name": "object-1"})
+	server.Seed(sqlPath, "sql-1", map[string]interface{}{
+		"name":       "sql-1",
+		"createTime": "2020-01-01T00:00:00Z",
+		"settings":   map[string]interface{}{"deletionProtectionEnabled": true},
+	})
+	server.Seed(gkePath, "cluster-1", map[string]interface{}{
+		"name":       "cluster-1",
+		"location":   testRegion,
+		"createTime": "2020-01-01T00:00:00Z",
+		"selfLink":   fmt.Sprintf("https://container.googleapis.com/v1/projects/%v/locations/%v/clusters/cluster-1", testProject, testRegion),
+	})
+	server.Seed(datasetPath, "dataset_1", map[string]interface{}{
+		"datasetReference": map[string]interface{}{"datasetId": "dataset_1", "projectId": testProject},
+		"creationTime":     "1577836800000",
+	})
+	server.Seed(secretsPath, "secret-1", map[string]interface{}{
+		"name":       fmt.Sprintf("projects/%v/secrets/secret-1", testProject),
+		"createTime": "2020-01-01T00:00:00Z",
+	})
+	server.Seed(locationsPath, testRegion, map[string]interface{}{
+		"name":       fmt.Sprintf("projects/%v/locations/%v", testProject, testRegion),
+		"locationId": testRegion,
+	})
+	server.Seed(functionsPath, "function-1", map[string]interface{}{
+		"name":       fmt.Sprintf("projects/%v/locations/%v/functions/function-1", testProject, testRegion),
+		"updateTime": "2020-01-01T00:00:00Z",
+	})
+}
+
+func deleteRequests(server *fakegcp.Server, itemPath string) int {
+	count := 0
+	for _, request := range server.Requests() {
+		if request == "DELETE "+itemPath {
+			count++
+		}
+	}
+	return count
+}
+
+func TestRemoveProjectResourcesDryRun(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+
+	if err := RemoveProjectResources(testConfig(server)); err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+
+	for _, request := range server.Requests() {
+		if !strings.HasPrefix(request, "GET ") {
+			t.Errorf("dry run sent a modifying request: %v", request)
+		}
+	}
+	if !server.Exists(zonePath+"/instances", "vm-1") {
+		t.Errorf("dry run removed an instance")
+	}
+}
+
+func TestRemoveProjectResources(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	// Every operation is polled a few times before it is done
+	server.OperationPolls = 2
+	seedProject(server)
+
+	runConfig := testConfig(server)
+	runConfig.NoDryRun = true
+	if err := RemoveProjectResources(runConfig); err != nil {
+		t.Fatalf("removal failed: %v", err)
+	}
+
+	for _, collectionPath := range []string{
+		zonePath + "/instances",
+		zonePath + "/disks",
+		regionPath + "/subnetworks",
+		globalPath + "/networks",
+		globalPath + "/firewalls",
+		globalPath + "/instanceTemplates",
+		bucketsPath,
+		bucketsPath + "/bucket-1/o",
+		sqlPath,
+		gkePath,
+		datasetPath,
+		secretsPath,
+		functionsPath,
+	} {
+		if remaining := server.Items(collectionPath); len(remaining) != 0 {
+			t.Errorf("%v not removed: %v", collectionPath, remaining)
+		}
+	}
+}
+
+func TestRemoveProjectResourcesWaitsForDependencies(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	server.BlockDelete(globalPath+"/networks/net-1", computePath+"/regions/*/subnetworks")
+
+	runConfig := testConfig(server)
+	runConfig.NoDryRun = true
+	if err := RemoveProjectResources(runConfig); err != nil {
+		t.Fatalf("removal failed: %v", err)
+	}
+
+	// ComputeNetworks depends on ComputeSubnetworks, so the network is only deleted once, after the subnetwork
+	if attempts := deleteRequests(server, globalPath+"/networks/net-1"); attempts != 1 {
+		t.Errorf("expected a single network deletion, got %v", attempts)
+	}
+	if server.Exists(globalPath+"/networks", "net-1") {
+		t.Errorf("network not removed")
+	}
+}
+
+func TestRemoveProjectResourcesRetriesInUse(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	server.InjectError(http.MethodDelete, globalPath+"/firewalls/fw-1", 2, http.StatusBadRequest, "resourceInUseByAnotherResource")
+
+	runConfig := testConfig(server)
+	runConfig.NoDryRun = true
+	if err := RemoveProjectResources(runConfig); err != nil {
+		t.Fatalf("removal failed: %v", err)
+	}
+
+	if attempts := deleteRequests(server, globalPath+"/firewalls/fw-1"); attempts != 3 {
+		t.Errorf("expected 3 firewall deletion attempts, got %v", attempts)
+	}
+	if server.Exists(globalPath+"/firewalls", "fw-1") {
+		t.Errorf("firewall not removed")
+	}
+}
+
+func TestParallelResourceDeletionInterruptedWhileInUse(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	server.InjectError(http.MethodDelete, globalPath+"/firewalls/fw-1", 100, http.StatusBadRequest, "resourceInUseByAnotherResource")
+
+	runConfig := testConfig(server)
+	runConfig.NoDryRun = true
+	runConfig.PollTime = 60
+	runConfig.Timeout = 600
+	runConfig.IncludeTypes = []string{"ComputeFirewalls"}
+	resourceMap, err := GetResourceMap(runConfig)
+	if err != nil {
+		t.Fatalf("unable to set up resources: %v", err)
+	}
+	firewalls := resourceMap["ComputeFirewalls"]
+	if _, err := firewalls.List(true); err != nil {
+		t.Fatalf("listing failed: %v", err)
+	}
+
+	// The progress summary of an interrupt reads the items while retries refresh them
+	progress := newDeletionProgress(resourceMap)
+	progress.snapshot()
+	stopped, stop := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- parallelResourceDeletion(stopped, firewalls, runConfig)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	progress.summary()
+	stop()
+
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "interrupted") {
+			t.Errorf("expected the deletion to be interrupted, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("deletion still waiting for the poll interval after the interruption")
+	}
+	if attempts := deleteRequests(server, globalPath+"/firewalls/fw-1"); attempts != 1 {
+		t.Errorf("expected a single firewall deletion attempt, got %v", attempts)
+	}
+}
+
+func TestRemoveProjectResourcesFilters(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	server.Seed(bucketsPath, "terraform-state", map[string]interface{}{"name": "terraform-state", "timeCreated": "2020-01-01T00:00:00Z"})
+	server.Seed(globalPath+"/networks", "default", map[string]interface{}{"name": "default", "creationTimestamp": "2020-01-01T00:00:00Z"})
+
+	runConfig := testConfig(server)
+	runConfig.NoDryRun = true
+	runConfig.Filters = map[string][]config.Filter{
+		"StorageBuckets":  {{Type: config.FilterExact, Value: "terraform-state"}},
+		"ComputeNetworks": {{Type: config.FilterExact, Value: "default"}},
+	}
+	if err := RemoveProjectResources(runConfig); err != nil {
+		t.Fatalf("removal failed: %v", err)
+	}
+
+	if remaining := server.Items(bucketsPath); len(remaining) != 1 || remaining[0] != "terraform-state" {
+		t.Errorf("expected only the filtered bucket to remain, got %v", remaining)
+	}
+	if remaining := server.Items(globalPath + "/networks"); len(remaining) != 1 || remaining[0] != "default" {
+		t.Errorf("expected only the filtered network to remain, got %v", remaining)
+	}
+}
+
+func TestRemoveProjectResourcesAge(t *testing.T) {
+	recent := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name      string
+		olderThan time.Duration
+		newerThan time.Duration
+		deleted   []string
+	}{
+		{"older than", 24 * time.Hour, 0, []string{"disk-1", "function-1", "dataset_1"}},
+		// A recently redeployed function may be older than it looks, so only its update time is not enough
+		{"newer than", 0, 2 * time.Hour, []string{"disk-recent"}},
+	}
+	for _, test := range tests {
+		server := fakegcp.NewServer()
+		seedProject(server)
+		server.Seed(zonePath+"/disks", "disk-recent", map[string]interface{}{"name": "disk-recent", "creationTimestamp": recent.Format(time.RFC3339)})
+		server.Seed(zonePath+"/disks", "disk-unknown", map[string]interface{}{"name": "disk-unknown"})
+		server.Seed(functionsPath, "function-redeployed", map[string]interface{}{
+			"name":       fmt.Sprintf("projects/%v/locations/%v/functions/function-redeployed", testProject, testRegion),
+			"updateTime": recent.Format(time.RFC3339),
+		})
+		server.Seed(datasetPath, "dataset_unknown", map[string]interface{}{
+			"datasetReference": map[string]interface{}{"datasetId": "dataset_unknown", "projectId": testProject},
+		})
+
+		runConfig := testConfig(server)
+		runConfig.NoDryRun = true
+		runConfig.IncludeTypes = []string{"ComputeDisks", "FunctionsInstances", "BigQueryDatasets"}
+		runConfig.OlderThan = test.olderThan
+		runConfig.NewerThan = test.newerThan
+		if err := RemoveProjectResources(runConfig); err != nil {
+			t.Fatalf("%v: removal failed: %v", test.name, err)
+		}
+
+		for collectionPath, items := range map[string][]string{
+			zonePath + "/disks": {"disk-1", "disk-recent", "disk-unknown"},
+			functionsPath:       {"function-1", "function-redeployed"},
+			datasetPath:         {"dataset_1", "dataset_unknown"},
+		} {
+			for _, item := range items {
+				deleted := helpers.SliceContains(test.deleted, item)
+				if exists := server.Exists(collectionPath, item); exists == deleted {
+					t.Errorf("%v: expected %v to be deleted: %v, but it exists: %v", test.name, item, deleted, exists)
+				}
+			}
+		}
+		server.Close()
+	}
+}
+
+func TestRemoveProjectResourcesReportsListErrors(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	server.InjectError(http.MethodGet, bucketsPath, 1, http.StatusInternalServerError, "backendError")
+
+	runConfig := testConfig(server)
+	runConfig.NoDryRun = true
+	err := RemoveProjectResources(runConfig)
+	if err == nil || !strings.Contains(err.Error(), "StorageBuckets (list)") {
+		t.Fatalf("expected the bucket listing error to be reported, got %v", err)
+	}
+
+	// Other resource types are unaffected
+	if server.Exists(globalPath+"/firewalls", "fw-1") {
+		t.Errorf("firewall not removed")
+	}
+	if !server.Exists(bucketsPath, "bucket-1") {
+		t.Errorf("bucket removed although it could not be listed")
+	}
+}
+
+func TestRemoveProjectResourcesPaginates(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	server.PageSize = 2
+	seedProject(server)
+	for i := 2; i <= 5; i++ {
+		server.Seed(globalPath+"/firewalls", fmt.Sprintf("fw-%v", i), map[string]interface{}{"name": fmt.Sprintf("fw-%v", i)})
+		server.Seed(zonePath+"/disks", fmt.Sprintf("disk-%v", i), map[string]interface{}{"name": fmt.Sprintf("disk-%v", i)})
+		server.Seed(bucketsPath, fmt.Sprintf("bucket-%v", i), map[string]interface{}{"name": fmt.Sprintf("bucket-%v", i)})
+		server.Seed(bucketsPath+"/bucket-1/o", fmt.Sprintf("object-%v", i), map[string]interface{}{"name": fmt.Sprintf("object-%v", i)})
+		server.Seed(secretsPath, fmt.Sprintf("secret-%v", i), map[string]interface{}{
+			"name": fmt.Sprintf("projects/%v/secrets/secret-%v", testProject, i),
+		})
+		server.Seed(datasetPath, fmt.Sprintf("dataset_%v", i), map[string]interface{}{
+			"datasetReference": map[string]interface{}{"datasetId": fmt.Sprintf("dataset_%v", i), "projectId": testProject},
+		})
+	}
+
+	runConfig := testConfig(server)
+	runConfig.NoDryRun = true
+	if err := RemoveProjectResources(runConfig); err != nil {
+		t.Fatalf("removal failed: %v", err)
+	}
+
+	for _, collectionPath := range []string{
+		globalPath + "/firewalls",
+		zonePath + "/disks",
+		bucketsPath,
+		bucketsPath + "/bucket-1/o",
+		secretsPath,
+		datasetPath,
+	} {
+		if remaining := server.Items(collectionPath); len(remaining) != 0 {
+			t.Errorf("%v not removed beyond the first page: %v", collectionPath, remaining)
+		}
+	}
+}
+
+func TestRemoveProjectResourcesLocations(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	for _, zone := range []string{testZone, "us-east1-b"} {
+		server.Seed(computePath+"/zones", zone, map[string]interface{}{"name": zone})
+	}
+	for _, region := range []string{testRegion, "us-east1"} {
+		server.Seed(computePath+"/regions", region, map[string]interface{}{"name": region})
+	}
+	otherZonePath := fmt.Sprintf("%v/zones/us-east1-b", computePath)
+	otherRegionPath := fmt.Sprintf("%v/regions/us-east1", computePath)
+	otherFunctionsPath := locationsPath + "/us-east1/functions"
+	otherGKEPath := fmt.Sprintf("%v/projects/%v/locations/us-east1-b/clusters", fakegcp.Container, testProject)
+	server.Seed(otherZonePath+"/disks", "disk-2", map[string]interface{}{"name": "disk-2"})
+	server.Seed(otherRegionPath+"/subnetworks", "subnet-2", map[string]interface{}{"name": "subnet-2"})
+	server.Seed(otherGKEPath, "cluster-2", map[string]interface{}{
+		"name":     "cluster-2",
+		"location": "us-east1-b",
+		"selfLink": fmt.Sprintf("https://container.googleapis.com/v1/projects/%v/zones/us-east1-b/clusters/cluster-2", testProject),
+	})
+	server.Seed(locationsPath, "us-east1", map[string]interface{}{
+		"name":       fmt.Sprintf("projects/%v/locations/us-east1", testProject),
+		"locationId": "us-east1",
+	})
+	server.Seed(otherFunctionsPath, "function-2", map[string]interface{}{
+		"name": fmt.Sprintf("projects/%v/locations/us-east1/functions/function-2", testProject),
+	})
+
+	runConfig := testConfig(server)
+	runConfig.NoDryRun = true
+	runConfig.IncludeTypes = []string{"ComputeDisks", "ComputeSubnetworks", "ContainerGKEClusters", "FunctionsInstances"}
+	runConfig.Regions = []string{"mars-*"}
+	if err := RemoveProjectResources(runConfig); err == nil || !strings.Contains(err.Error(), "mars-*") {
+		t.Fatalf("expected an error about the unknown region, got %v", err)
+	}
+
+	// Zones are restricted to the selected regions
+	runConfig.Regions = []string{"europe-*"}
+	if err := RemoveProjectResources(runConfig); err != nil {
+		t.Fatalf("removal failed: %v", err)
+	}
+	if server.Exists(zonePath+"/disks", "disk-1") || server.Exists(regionPath+"/subnetworks", "subnet-1") ||
+		server.Exists(gkePath, "cluster-1") || server.Exists(functionsPath, "function-1") {
+		t.Errorf("items in the selected locations not removed")
+	}
+	if !server.Exists(otherZonePath+"/disks", "disk-2") || !server.Exists(otherRegionPath+"/subnetworks", "subnet-2") ||
+		!server.Exists(otherGKEPath, "cluster-2") || !server.Exists(otherFunctionsPath, "function-2") {
+		t.Errorf("items outside of the selected locations removed")
+	}
+	for _, request := range server.Requests() {
+		if request == "GET "+otherFunctionsPath {
+			t.Errorf("functions of an unselected region listed")
+		}
+	}
+
+	// Global items are kept by a restricted run, unless they are included explicitly
+	runConfig.IncludeTypes = []string{"ComputeFirewalls", "ComputeNetworks", "ComputeInstanceTemplates", "SecretManagerSecrets"}
+	if err := RemoveProjectResources(runConfig); err != nil {
+		t.Fatalf("removal failed: %v", err)
+	}
+	globalItems := map[string]string{
+		globalPath + "/firewalls":         "fw-1",
+		globalPath + "/networks":          "net-1",
+		globalPath + "/instanceTemplates": "template-1",
+		secretsPath:                       "secret-1",
+	}
+	for collectionPath, item := range globalItems {
+		if !server.Exists(collectionPath, item) {
+			t.Errorf("global item %v removed by a run restricted to regions", item)
+		}
+	}
+	runConfig.IncludeGlobal = true
+	if err := RemoveProjectResources(runConfig); err != nil {
+		t.Fatalf("removal failed: %v", err)
+	}
+	for collectionPath, item := range globalItems {
+		if server.Exists(collectionPath, item) {
+			t.Errorf("global item %v not removed with IncludeGlobal", item)
+		}
+	}
+	runConfig.IncludeGlobal = false
+
+	// Regions are restricted to the regions of the selected zones
+	runConfig.Regions = nil
+	runConfig.Zones = []string{"us-east1-b"}
+	runConfig.IncludeTypes = []string{"ComputeSubnetworks"}
+	if err := RemoveProjectResources(runConfig); err != nil {
+		t.Fatalf("removal failed: %v", err)
+	}
+	if server.Exists(otherRegionPath+"/subnetworks", "subnet-2") {
+		t.Errorf("items in the region of the selected zone not removed")
+	}
+
+	// Without a restriction every location is discovered through the aggregated lists
+	runConfig.Zones = nil
+	runConfig.IncludeTypes = []string{"ComputeDisks", "ContainerGKEClusters", "FunctionsInstances"}
+	if err := RemoveProjectResources(runConfig); err != nil {
+		t.Fatalf("removal failed: %v", err)
+	}
+	if server.Exists(otherZonePath+"/disks", "disk-2") || server.Exists(otherGKEPath, "cluster-2") || server.Exists(otherFunctionsPath, "function-2") {
+		t.Errorf("items in other locations not removed")
+	}
+}
+
+func TestRemoveProjectResourcesRetriesFailedOperations(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	server.FailOperation(zonePath+"/disks/disk-1", 1, "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE")
+
+	runConfig := testConfig(server)
+	runConfig.NoDryRun = true
+	if err := RemoveProjectResources(runConfig); err != nil {
+		t.Fatalf("removal failed: %v", err)
+	}
+
+	if attempts := deleteRequests(server, zonePath+"/disks/disk-1"); attempts != 2 {
+		t.Errorf("expected 2 disk deletion attempts, got %v", attempts)
+	}
+	if server.Exists(zonePath+"/disks", "disk-1") {
+		t.Errorf("disk not removed")
+	}
+}
+
+func TestRemoveProjectResourcesReportsFailedOperations(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	server.FailOperation(gkePath+"/cluster-1", 1, "INTERNAL")
+	server.FailOperation(zonePath+"/disks/disk-1", 1, "INVALID_FIELD_VALUE")
+
+	runConfig := testConfig(server)
+	runConfig.NoDryRun = true
+	err := RemoveProjectResources(runConfig)
+	if err == nil {
+		t.Fatalf("expected the failed operations to be reported")
+	}
+	for _, expected := range []string{
+		"ContainerGKEClusters (remove)", "INTERNAL",
+		"ComputeDisks (remove)", "INVALID_FIELD_VALUE",
+		"ComputeFirewalls (remove): skipped, dependency ContainerGKEClusters was not deleted",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in the error, got %v", expected, err)
+		}
+	}
+	if !server.Exists(gkePath, "cluster-1") || !server.Exists(zonePath+"/disks", "disk-1") {
+		t.Errorf("items of failed operations removed")
+	}
+}
+
+func TestRemoveProjectResourcesInterrupted(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	server.OperationPolls = 2
+	interrupted := false
+	server.OnRequest = func(method, requestPath string) {
+		if method == http.MethodDelete && !interrupted {
+			interrupted = true
+			syscall.Kill(os.Getpid(), syscall.SIGINT)
+		}
+	}
+
+	runConfig := testConfig(server)
+	runConfig.NoDryRun = true
+	runConfig.Concurrency = 1
+	err := RemoveProjectResources(runConfig)
+	if err == nil || !strings.Contains(err.Error(), "interrupted") {
+		t.Fatalf("expected the run to report the interruption, got %v", err)
+	}
+
+	// Only the resource type in flight at the interruption completes its deletions, nothing else is started
+	deleted := []string{}
+	for _, request := range server.Requests() {
+		if strings.HasPrefix(request, "DELETE ") {
+			deleted = append(deleted, strings.TrimPrefix(request, "DELETE "))
+		}
+	}
+	if len(deleted) == 0 {
+		t.Fatal("expected the in-flight deletion to complete")
+	}
+	service := strings.Split(deleted[0], "/")[1]
+	for _, item := range deleted {
+		if strings.Split(item, "/")[1] != service {
+			t.Errorf("expected only %v deletions after the interruption, got %v", service, deleted)
+		}
+		collectionPath, name := path.Split(item)
+		if server.Exists(strings.TrimSuffix(collectionPath, "/"), name) {
+			t.Errorf("in-flight deletion of %v not completed", item)
+		}
+	}
+}
+
+func TestRemoveProjectResourcesCheckpoint(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	server.Seed(globalPath+"/networks", "default", map[string]interface{}{"name": "default", "creationTimestamp": "2020-01-01T00:00:00Z"})
+
+	checkpointFile := path.Join(t.TempDir(), "checkpoint.json")
+	runConfig := testConfig(server)
+	runConfig.NoDryRun = true
+	runConfig.CheckpointFile = checkpointFile
+	runConfig.Filters = map[string][]config.Filter{"ComputeNetworks": {{Type: config.FilterExact, Value: "default"}}}
+	if err := RemoveProjectResources(runConfig); err != nil {
+		t.Fatalf("removal failed: %v", err)
+	}
+
+	written, err := loadCheckpoint(checkpointFile, testProject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]map[string]string{
+		"ComputeDisks":    {"disk-1": itemDeleted},
+		"ComputeNetworks": {"net-1": itemDeleted, "default": itemFiltered},
+		"StorageBuckets":  {"bucket-1": itemDeleted},
+	} {
+		for item, status := range expected {
+			if state := written.Resources[name][item]; state == nil || state.Status != status {
+				t.Errorf("expected %v %v to be %v, got %+v", name, item, status, state)
+			}
+		}
+	}
+	if len(written.Operations) != 0 {
+		t.Errorf("expected no pending operations, got %+v", written.Operations)
+	}
+}
+
+func TestRemoveProjectResourcesResume(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	server.OperationPolls = 2
+
+	// An earlier run deleted disk-0 and was interrupted while waiting for the deletion of disk-2
+	checkpointFile := path.Join(t.TempDir(), "checkpoint.json")
+	interrupted := newCheckpoint(checkpointFile, testProject)
+	interrupted.Resources["ComputeDisks"] = map[string]*checkpointItem{
+		"disk-0": {Status: itemDeleted},
+		"disk-2": {Status: itemDeleting},
+	}
+	operationName := server.StartOperation(zonePath)
+	interrupted.addOperation(operationRef{Service: "compute", Name: operationName, Zone: testZone}, "deletion of disk-2")
+
+	if _, err := loadCheckpoint(checkpointFile, "other-project"); err == nil {
+		t.Errorf("expected a checkpoint of another project to be rejected")
+	}
+
+	runConfig := testConfig(server)
+	runConfig.NoDryRun = true
+	runConfig.CheckpointFile = checkpointFile
+	runConfig.Resume = true
+	if err := RemoveProjectResources(runConfig); err != nil {
+		t.Fatalf("resumed removal failed: %v", err)
+	}
+
+	polled := false
+	for _, request := range server.Requests() {
+		polled = polled || request == "GET "+zonePath+"/operations/"+operationName
+	}
+	if !polled {
+		t.Errorf("pending operation %v was not waited for", operationName)
+	}
+
+	written, err := loadCheckpoint(checkpointFile, testProject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range []string{"disk-0", "disk-1", "disk-2"} {
+		if state := written.Resources["ComputeDisks"][item]; state == nil || state.Status != itemDeleted {
+			t.Errorf("expected %v to be deleted, got %+v", item, state)
+		}
+	}
+	if len(written.Operations) != 0 {
+		t.Errorf("expected no pending operations, got %+v", written.Operations)
+	}
+}
+
+func TestRemoveProjectsResume(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	otherProject := "test-project-2"
+	otherZonePath := fmt.Sprintf("%v/projects/%v/zones/%v", fakegcp.Compute, otherProject, testZone)
+	server.Seed(otherZonePath+"/disks", "disk-1", map[string]interface{}{"name": "disk-1", "creationTimestamp": "2020-01-01T00:00:00Z"})
+
+	// The earlier run died while nuking the first project, before the second one was started
+	directory := t.TempDir()
+	started := newCheckpoint(path.Join(directory, "run."+testProject+".json"), testProject)
+	started.Resources["ComputeDisks"] = map[string]*checkpointItem{"disk-0": {Status: itemDeleted}}
+	started.save()
+
+	configs := []config.Config{}
+	for _, project := range []string{testProject, otherProject} {
+		projectConfig := testConfig(server)
+		projectConfig.Project = project
+		projectConfig.NoDryRun = true
+		projectConfig.IncludeTypes = []string{"ComputeDisks"}
+		projectConfig.CheckpointFile = path.Join(directory, "run."+project+".json")
+		projectConfig.Resume = true
+		configs = append(configs, projectConfig)
+	}
+	if err := RemoveProjects(configs, 1); err != nil {
+		t.Fatalf("resumed removal failed: %v", err)
+	}
+
+	if server.Exists(zonePath+"/disks", "disk-1") || server.Exists(otherZonePath+"/disks", "disk-1") {
+		t.Errorf("expected the disks of both projects to be deleted")
+	}
+	written, err := loadCheckpoint(configs[1].CheckpointFile, otherProject)
+	if err != nil {
+		t.Fatalf("expected a checkpoint of the project which had not started: %v", err)
+	}
+	if state := written.Resources["ComputeDisks"]["disk-1"]; state == nil || state.Status != itemDeleted {
+		t.Errorf("expected disk-1 to be deleted, got %+v", state)
+	}
+}
+
+// captureReport - collects the JSON or NDJSON report of the test
+func captureReport(t *testing.T) *bytes.Buffer {
+	output := &bytes.Buffer{}
+	reportWriter = output
+	t.Cleanup(func() {
+		reportWriter = os.Stdout
+	})
+	return output
+}
+
+func TestRemoveProjectResourcesReport(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	server.Seed(globalPath+"/networks", "default", map[string]interface{}{
+		"name":              "default",
+		"creationTimestamp": "2020-01-01T00:00:00Z",
+		"peerings":          []interface{}{map[string]interface{}{"name": "peering-1"}},
+	})
+	server.InjectError(http.MethodDelete, zonePath+"/instances/vm-1", 1, http.StatusForbidden, "forbidden")
+
+	runConfig := testConfig(server)
+	runConfig.Filters = map[string][]config.Filter{"ComputeNetworks": {{Type: config.FilterExact, Value: "default"}}}
+
+	// Dry run as NDJSON, one item per line
+	runConfig.Output = config.OutputNDJSON
+	output := captureReport(t)
+	if err := RemoveProjectResources(runConfig); err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	dryRun := map[string]reportItem{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		item := reportItem{}
+		if err := json.Unmarshal([]byte(line), &item); err != nil {
+			t.Fatalf("invalid NDJSON line %q: %v", line, err)
+		}
+		dryRun[item.Type+"/"+item.Name] = item
+	}
+
+	// Deletion as a JSON array
+	runConfig.Output = config.OutputJSON
+	runConfig.NoDryRun = true
+	output.Reset()
+	if err := RemoveProjectResources(runConfig); err == nil {
+		t.Fatalf("expected the instance deletion to fail")
+	}
+	items := []reportItem{}
+	if err := json.Unmarshal(output.Bytes(), &items); err != nil {
+		t.Fatalf("invalid JSON report: %v", err)
+	}
+	deletion := map[string]reportItem{}
+	for _, item := range items {
+		deletion[item.Type+"/"+item.Name] = item
+	}
+
+	for key, expected := range map[string][2]string{
+		"ComputeDisks/disk-1":              {actionWouldDelete, actionDeleted},
+		"ComputeInstances/vm-1":            {actionWouldDelete, actionFailed},
+		"ComputeNetworks/default":          {actionFiltered, actionFiltered},
+		"ComputeNetworkPeerings/peering-1": {actionWouldDelete, actionDeleted},
+		"ComputeSubnetworks/subnet-1":      {actionWouldDelete, actionDeleted},
+		"StorageBuckets/bucket-1":          {actionWouldDelete, actionDeleted},
+		"SecretManagerSecrets/" + fmt.Sprintf("projects/%v/secrets/secret-1", testProject): {actionWouldDelete, actionDeleted},
+	} {
+		if dryRun[key].Action != expected[0] || deletion[key].Action != expected[1] {
+			t.Errorf("expected %v to be %v then %v, got %v then %v", key, expected[0], expected[1], dryRun[key].Action, deletion[key].Action)
+		}
+	}
+	if len(dryRun) != len(deletion) {
+		t.Errorf("expected the dry run and the deletion to report the same items, got %v and %v", len(dryRun), len(deletion))
+	}
+
+	vm := deletion["ComputeInstances/vm-1"]
+	if vm.Project != testProject || vm.Location != testZone || vm.Error == "" {
+		t.Errorf("unexpected report of the failed instance: %+v", vm)
+	}
+	if sql := deletion["SqlInstances/sql-1"]; !sql.Protected {
+		t.Errorf("expected the sql instance to be reported as protected: %+v", sql)
+	}
+	if filtered := deletion["ComputeNetworks/default"]; filtered.Reason == "" || filtered.Location != "global" {
+		t.Errorf("unexpected report of the filtered network: %+v", filtered)
+	}
+}
+
+func TestRemoveProjectResourcesJSONStdout(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	interrupted := false
+	server.OnRequest = func(method, requestPath string) {
+		if method == http.MethodDelete && !interrupted {
+			interrupted = true
+			syscall.Kill(os.Getpid(), syscall.SIGINT)
+		}
+	}
+
+	// Everything written to stdout is collected, as a pipeline reading the report would
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	answerReader, answerWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, stdin := os.Stdout, os.Stdin
+	os.Stdout, os.Stdin, reportWriter = writer, answerReader, writer
+	t.Cleanup(func() {
+		os.Stdout, os.Stdin, reportWriter = stdout, stdin, stdout
+	})
+	collected := make(chan []byte)
+	go func() {
+		output, _ := io.ReadAll(reader)
+		collected <- output
+	}()
+
+	// An interactive confirmation and an interruption during a JSON run
+	answerWriter.WriteString(testProject + "\n")
+	if err := helpers.Prompt("Do you really want to nuke project "+testProject+"?", testProject); err != nil {
+		t.Fatalf("confirmation failed: %v", err)
+	}
+	runConfig := testConfig(server)
+	runConfig.NoDryRun = true
+	runConfig.Output = config.OutputJSON
+	if err := RemoveProjectResources(runConfig); err == nil {
+		t.Fatalf("expected the run to be interrupted")
+	}
+	writer.Close()
+
+	output := <-collected
+	items := []reportItem{}
+	if err := json.Unmarshal(output, &items); err != nil {
+		t.Fatalf("stdout is not a JSON report: %v\n%s", err, output)
+	}
+	if len(items) == 0 {
+		t.Errorf("expected the report to contain the items of the run")
+	}
+}
+
+func TestPlanApply(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+
+	planFile := path.Join(t.TempDir(), "nuke.plan")
+	runConfig := testConfig(server)
+	runConfig.IncludeTypes = []string{"ComputeDisks", "StorageBuckets"}
+	if err := WritePlan(runConfig, planFile); err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	for _, request := range server.Requests() {
+		if !strings.HasPrefix(request, "GET ") {
+			t.Errorf("plan sent a modifying request: %v", request)
+		}
+	}
+
+	if _, err := ReadPlan(planFile, "other-project"); err == nil || !strings.Contains(err.Error(), "other-project") {
+		t.Errorf("expected a plan of another project to be rejected, got %v", err)
+	}
+	data, err := os.ReadFile(planFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamperedFile := path.Join(t.TempDir(), "tampered.plan")
+	os.WriteFile(tamperedFile, bytes.Replace(data, []byte("disk-1"), []byte("disk-9"), 1), 0600)
+	if _, err := ReadPlan(tamperedFile, testProject); err == nil || !strings.Contains(err.Error(), "hash") {
+		t.Errorf("expected a modified plan to be rejected, got %v", err)
+	}
+
+	plan, err := ReadPlan(planFile, testProject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if types := plan.ResourceTypes(); !reflect.DeepEqual(types, []string{"ComputeDisks", "StorageBuckets"}) {
+		t.Errorf("unexpected resource types of the plan: %v", types)
+	}
+
+	// Created after the plan was reviewed, so it has to be kept
+	server.Seed(zonePath+"/disks", "disk-2", map[string]interface{}{"name": "disk-2", "creationTimestamp": "2020-01-01T00:00:00Z"})
+
+	applyConfig := testConfig(server)
+	applyConfig.NoDryRun = true
+	applyConfig.Plan = plan.Items()
+	applyConfig.IncludeTypes = plan.ResourceTypes()
+	if err := RemoveProjectResources(applyConfig); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if remaining := server.Items(zonePath + "/disks"); !reflect.DeepEqual(remaining, []string{"disk-2"}) {
+		t.Errorf("expected only the disk created after the plan to remain, got %v", remaining)
+	}
+	if len(server.Items(bucketsPath)) != 0 {
+		t.Errorf("expected the planned bucket to be deleted")
+	}
+	if !server.Exists(zonePath+"/instances", "vm-1") {
+		t.Errorf("expected the instance, which is not part of the plan, to remain")
+	}
+}
+
+func TestPlanApplyRecreatedItem(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	server.Seed(zonePath+"/disks", "disk-2", map[string]interface{}{"name": "disk-2", "creationTimestamp": "2020-01-01T00:00:00Z"})
+
+	planFile := path.Join(t.TempDir(), "nuke.plan")
+	runConfig := testConfig(server)
+	runConfig.IncludeTypes = []string{"ComputeDisks"}
+	if err := WritePlan(runConfig, planFile); err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	plan, err := ReadPlan(planFile, testProject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleted and created again under the same name after the plan was reviewed
+	server.Seed(zonePath+"/disks", "disk-1", map[string]interface{}{"name": "disk-1", "creationTimestamp": "2024-05-01T00:00:00Z"})
+
+	applyConfig := testConfig(server)
+	applyConfig.NoDryRun = true
+	applyConfig.Plan = plan.Items()
+	applyConfig.IncludeTypes = plan.ResourceTypes()
+	if err := RemoveProjectResources(applyConfig); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if remaining := server.Items(zonePath + "/disks"); !reflect.DeepEqual(remaining, []string{"disk-1"}) {
+		t.Errorf("expected only the recreated disk to remain, got %v", remaining)
+	}
+}
+
+func TestRemoveProjects(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	otherProject := "test-project-2"
+	otherZonePath := fmt.Sprintf("%v/projects/%v/zones/%v", fakegcp.Compute, otherProject, testZone)
+	server.Seed(otherZonePath+"/disks", "disk-1", map[string]interface{}{"name": "disk-1", "creationTimestamp": "2020-01-01T00:00:00Z"})
+	server.Seed(otherZonePath+"/disks", "disk-2", map[string]interface{}{"name": "disk-2", "creationTimestamp": "2020-01-01T00:00:00Z"})
+	failingProject := "test-project-3"
+	server.InjectError(http.MethodGet, fmt.Sprintf("%v/projects/%v/aggregated/disks", fakegcp.Compute, failingProject), 1, http.StatusForbidden, "forbidden")
+
+	configs := []config.Config{}
+	for _, project := range []string{testProject, otherProject, failingProject} {
+		projectConfig := testConfig(server)
+		projectConfig.Project = project
+		projectConfig.NoDryRun = true
+		projectConfig.IncludeTypes = []string{"ComputeDisks"}
+		projectConfig.Output = config.OutputJSON
+		configs = append(configs, projectConfig)
+	}
+	output := captureReport(t)
+	err := RemoveProjects(configs, 2)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 projects failed") || !strings.Contains(err.Error(), failingProject) {
+		t.Fatalf("expected only %v to fail, got %v", failingProject, err)
+	}
+
+	if len(server.Items(zonePath+"/disks")) != 0 || len(server.Items(otherZonePath+"/disks")) != 0 {
+		t.Errorf("expected the disks of both projects to be deleted, got %v and %v", server.Items(zonePath+"/disks"), server.Items(otherZonePath+"/disks"))
+	}
+
+	// A single report for every project
+	items := []reportItem{}
+	if err := json.Unmarshal(output.Bytes(), &items); err != nil {
+		t.Fatalf("invalid JSON report: %v", err)
+	}
+	deleted := []string{}
+	for _, item := range items {
+		if item.Action == actionDeleted {
+			deleted = append(deleted, item.Project+"/"+item.Name)
+		}
+	}
+	expected := []string{testProject + "/disk-1", otherProject + "/disk-1", otherProject + "/disk-2"}
+	if !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("expected deleted items %v, got %v", expected, deleted)
+	}
+}
+
+func TestRemoveProjectsCountdownsInParallel(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+
+	configs := []config.Config{}
+	for i := 1; i <= 3; i++ {
+		projectConfig := testConfig(server)
+		projectConfig.Project = fmt.Sprintf("test-project-%v", i)
+		projectConfig.NoDryRun = true
+		projectConfig.ForceSleep = 1
+		projectConfig.IncludeTypes = []string{"ComputeDisks"}
+		configs = append(configs, projectConfig)
+	}
+	started := time.Now()
+	if err := RemoveProjects(configs, 3); err != nil {
+		t.Fatalf("removal failed: %v", err)
+	}
+	// One after another the countdowns would take 3 seconds
+	if elapsed := time.Since(started); elapsed > 2500*time.Millisecond {
+		t.Errorf("expected the countdowns of parallel projects to overlap, took %v", elapsed)
+	}
+}
+
+func TestRemoveProjectResourcesNoKeepProject(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	seedProject(server)
+	projectsPath := fakegcp.CloudResourceManager + "/projects"
+	liensPath := fakegcp.CloudResourceManager + "/liens"
+	server.Seed(projectsPath, testProject, map[string]interface{}{"name": "projects/" + testProject, "projectId": testProject, "state": "ACTIVE"})
+	projectDeletes := func() int {
+		return deleteRequests(server, projectsPath+"/"+testProject)
+	}
+
+	runConfig := testConfig(server)
+	runConfig.NoKeepProject = true
+	runConfig.ProjectTimeout = 30
+	runConfig.IncludeTypes = []string{"ComputeDisks", "StorageBuckets"}
+	if err := RemoveProjectResources(runConfig); err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if projectDeletes() != 0 {
+		t.Fatalf("project deleted on a dry run")
+	}
+
+	// Resources which could not be listed keep the project
+	runConfig.NoDryRun = true
+	server.InjectError(http.MethodGet, computePath+"/aggregated/disks", 1, http.StatusForbidden, "forbidden")
+	if err := RemoveProjectResources(runConfig); err == nil || !strings.Contains(err.Error(), "Project (remove)") {
+		t.Fatalf("expected the project to be kept, got %v", err)
+	}
+	if projectDeletes() != 0 {
+		t.Fatalf("project deleted although a resource type failed")
+	}
+
+	// Liens are reported with their origin and keep the project, unless they are removed
+	server.Seed(liensPath, "1", map[string]interface{}{
+		"name": "liens/1", "parent": "projects/" + testProject, "origin": "xpn.googleapis.com", "reason": "Shared VPC host",
+	})
+	lienReport := func(expectError bool) reportItem {
+		output := captureReport(t)
+		runConfig.Output = config.OutputJSON
+		defer func() { runConfig.Output = "" }()
+		if err := RemoveProjectResources(runConfig); (err != nil) != expectError {
+			t.Fatalf("expected an error: %v, got %v", expectError, err)
+		}
+		items := []reportItem{}
+		if err := json.Unmarshal(output.Bytes(), &items); err != nil {
+			t.Fatalf("invalid report: %v", err)
+		}
+		for _, item := range items {
+			if item.Type == "Lien" {
+				return item
+			}
+		}
+		t.Fatalf("lien missing from the report: %v", items)
+		return reportItem{}
+	}
+	expected := reportItem{
+		Project: testProject, Type: "Lien", Name: "liens/1", Location: "global", Labels: map[string]string{},
+		Reason: "Shared VPC host", Origin: "xpn.googleapis.com",
+	}
+	for _, run := range []struct {
+		noDryRun, removeLiens, expectError bool
+		action                             string
+	}{
+		{false, false, false, actionBlocking},
+		{false, true, false, actionWouldDelete},
+		{true, false, true, actionBlocking},
+	} {
+		runConfig.NoDryRun, runConfig.RemoveLiens = run.noDryRun, run.removeLiens
+		expected.Action = run.action
+		if lien := lienReport(run.expectError); !reflect.DeepEqual(lien, expected) {
+			t.Errorf("no-dryrun %v, remove-liens %v: got %+v, expected %+v", run.noDryRun, run.removeLiens, lien, expected)
+		}
+	}
+	if projectDeletes() != 0 || !server.Exists(liensPath, "1") {
+		t.Fatalf("project or lien deleted although the lien is kept")
+	}
+
+	runConfig.NoDryRun, runConfig.RemoveLiens = true, true
+	expected.Action = actionDeleted
+	if lien := lienReport(false); !reflect.DeepEqual(lien, expected) {
+		t.Errorf("got %+v, expected %+v", lien, expected)
+	}
+	if server.Exists(liensPath, "1") {
+		t.Errorf("lien not removed")
+	}
+	if projectDeletes() != 1 || server.Field(projectsPath, testProject, "state") != "DELETE_REQUESTED" {
+		t.Errorf("project not deleted exactly once: %v deletions", projectDeletes())
+	}
+	if server.Exists(zonePath+"/disks", "disk-1") || server.Exists(bucketsPath, "bucket-1") {
+		t.Errorf("resources not deleted before the project")
+	}
+}
+
+func TestRestoreProject(t *testing.T) {
+	server := fakegcp.NewServer()
+	defer server.Close()
+	projectsPath := fakegcp.CloudResourceManager + "/projects"
+	server.Seed(fakegcp.CloudResourceManager+"/folders", "folders/2", map[string]interface{}{"name": "folders/2", "parent": "folders/1"})
+	for _, project := range []struct{ id, parent, state string }{
+		{testProject, "folders/2", "DELETE_REQUESTED"},
+		{"other-deleted", "folders/1", "DELETE_REQUESTED"},
+		{"active", "folders/1", "ACTIVE"},
+		{"elsewhere-deleted", "folders/9", "DELETE_REQUESTED"},
+	} {
+		server.Seed(projectsPath, project.id, map[string]interface{}{
+			"name": "projects/" + project.id, "projectId": project.id, "parent": project.parent, "state": project.state,
+		})
+	}
+
+	runConfig := testConfig(server)
+	deleted, err := DeletedProjects(runConfig, []string{"folders/1"})
+	if err != nil {
+		t.Fatalf("listing deleted projects failed: %v", err)
+	}
+	ids := []string{}
+	for _, project := range deleted {
+		ids = append(ids, project.ProjectId)
+	}
+	if !reflect.DeepEqual(ids, []string{"other-deleted", testProject}) {
+		t.Errorf("unexpected projects pending deletion: %v", ids)
+	}
+
+	if err := RestoreProject(runConfig); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if state := server.Field(projectsPath, testProject, "state"); state != "ACTIVE" {
+		t.Errorf("project not restored, state %v", state)
+	}
+	// Only projects pending deletion can be restored
+	if err := RestoreProject(runConfig); err == nil || !strings.Contains(err.Error(), "ACTIVE") {
+		t.Errorf("expected an error restoring an active project, got %v", err)
+	}
+}
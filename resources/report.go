@@ -0,0 +1,355 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ianbrown78/gcp-nuke/config"
+	"github.com/ianbrown78/gcp-nuke/helpers"
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+// Actions of the items in a run report
+const (
+	actionWouldDelete = "would-delete"
+	actionDeleted     = "deleted"
+	actionFiltered    = "filtered"
+	actionFailed      = "failed"
+	// actionBlocking - a lien which prevents the deletion of the project, as it is not removed
+	actionBlocking = "blocking"
+)
+
+// reportWriter - destination of JSON and NDJSON reports, shared by every project of a run
+var (
+	reportWriter io.Writer = os.Stdout
+	reportMutex  sync.Mutex
+)
+
+// reportItem - outcome of one item, with the same schema for dry runs and deletions so they can be compared
+type reportItem struct {
+	Project   string            `json:"project"`
+	Type      string            `json:"type"`
+	Name      string            `json:"name"`
+	Location  string            `json:"location"`
+	Labels    map[string]string `json:"labels"`
+	Protected bool              `json:"protected"`
+	Action    string            `json:"action"`
+	// Reason - why a filtered item is kept, or why a lien was placed
+	Reason string `json:"reason,omitempty"`
+	// Origin - who or what created a lien
+	Origin string `json:"origin,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// runReport - collects the outcome of every item of a project. NDJSON is written as soon as an outcome is known,
+// JSON once every project of the run is over.
+type runReport struct {
+	mutex   sync.Mutex
+	format  string
+	project string
+	// pending - listed items waiting for the deletion of their type
+	pending map[string]map[string]reportItem
+	items   []reportItem
+}
+
+func newRunReport(config config.Config) *runReport {
+	return &runReport{
+		format:  config.Output,
+		project: config.Project,
+		pending: make(map[string]map[string]reportItem),
+		items:   []reportItem{},
+	}
+}
+
+// recordInventory - filtered items are final, listed ones would be deleted on a dry run and are pending otherwise.
+// Types which could not be listed are left out.
+func (r *runReport) recordInventory(resourceMap map[string]Resource, dryRun bool, listFailed func(name string) bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	outcomes := []reportItem{}
+	for name, resource := range resourceMap {
+		if listFailed(name) {
+			continue
+		}
+		properties := resource.Properties()
+		newItem := func(item string) reportItem {
+			labels := properties[item].labels
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			return reportItem{
+				Project:   r.project,
+				Type:      name,
+				Name:      item,
+				Location:  properties[item].location(),
+				Labels:    labels,
+				Protected: properties[item].protected,
+			}
+		}
+
+		for item, reason := range resource.Filtered() {
+			filtered := newItem(item)
+			filtered.Action = actionFiltered
+			filtered.Reason = reason
+			outcomes = append(outcomes, filtered)
+		}
+		r.pending[name] = make(map[string]reportItem)
+		for _, item := range resource.ToSlice() {
+			listed := newItem(item)
+			if dryRun {
+				listed.Action = actionWouldDelete
+				outcomes = append(outcomes, listed)
+				continue
+			}
+			r.pending[name][item] = listed
+		}
+	}
+	r.emit(outcomes)
+}
+
+// finishType - pending items of a resource type which are no longer listed are deleted, the others failed with err
+func (r *runReport) finishType(name string, remaining []string, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	outcomes := []reportItem{}
+	for item, outcome := range r.pending[name] {
+		switch {
+		case !helpers.SliceContains(remaining, item):
+			outcome.Action = actionDeleted
+		case err != nil:
+			outcome.Action = actionFailed
+			outcome.Error = err.Error()
+		default:
+			outcome.Action = actionFailed
+			outcome.Error = "still exists after its deletion"
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	delete(r.pending, name)
+	r.emit(outcomes)
+}
+
+// close - items still pending were never deleted, as the run was interrupted or aborted before them
+func (r *runReport) close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	outcomes := []reportItem{}
+	for name, items := range r.pending {
+		for _, outcome := range items {
+			outcome.Action = actionFailed
+			outcome.Error = "not deleted, the run was interrupted or aborted"
+			outcomes = append(outcomes, outcome)
+		}
+		delete(r.pending, name)
+	}
+	r.emit(outcomes)
+}
+
+// recordProject - outcome of the deletion of the project itself
+func (r *runReport) recordProject(action string, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	outcome := reportItem{
+		Project:  r.project,
+		Type:     "Project",
+		Name:     r.project,
+		Location: "global",
+		Labels:   map[string]string{},
+		Action:   action,
+	}
+	if err != nil {
+		outcome.Error = err.Error()
+	}
+	r.emit([]reportItem{outcome})
+}
+
+// recordLiens - outcome of the liens on the project, err is the error of every one of them
+func (r *runReport) recordLiens(liens []*cloudresourcemanager.Lien, action string, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	outcomes := []reportItem{}
+	for _, lien := range liens {
+		outcome := reportItem{
+			Project:  r.project,
+			Type:     "Lien",
+			Name:     lien.Name,
+			Location: "global",
+			Labels:   map[string]string{},
+			Action:   action,
+			Reason:   lien.Reason,
+			Origin:   lien.Origin,
+		}
+		if err != nil {
+			outcome.Error = err.Error()
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	r.emit(outcomes)
+}
+
+// liens - reported liens, in the order they were recorded
+func (r *runReport) liens() []reportItem {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	liens := []reportItem{}
+	for _, item := range r.items {
+		if item.Type == "Lien" {
+			liens = append(liens, item)
+		}
+	}
+	return liens
+}
+
+// counts - number of items by action
+func (r *runReport) counts() map[string]int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	counts := make(map[string]int)
+	for _, item := range r.items {
+		counts[item.Action]++
+	}
+	return counts
+}
+
+// emit - adds outcomes to the report, written right away as NDJSON. The caller holds the mutex.
+func (r *runReport) emit(outcomes []reportItem) {
+	sortReportItems(outcomes)
+	r.items = append(r.items, outcomes...)
+	if r.format != config.OutputNDJSON {
+		return
+	}
+	reportMutex.Lock()
+	defer reportMutex.Unlock()
+	encoder := json.NewEncoder(reportWriter)
+	for _, outcome := range outcomes {
+		encoder.Encode(outcome)
+	}
+}
+
+func sortReportItems(items []reportItem) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Project != items[j].Project {
+			return items[i].Project < items[j].Project
+		}
+		if items[i].Type != items[j].Type {
+			return items[i].Type < items[j].Type
+		}
+		return items[i].Name < items[j].Name
+	})
+}
+
+// runErrors - errors collected per resource type, so that one failing type does not stop the others
+type runErrors struct {
+	project string
+	mutex   sync.Mutex
+	errors  []resourceError
+}
+
+type resourceError struct {
+	resourceName string
+	// phase - list or remove
+	phase string
+	err   error
+}
+
+func newRunErrors(project string) *runErrors {
+	return &runErrors{project: project}
+}
+
+func (r *runErrors) add(resourceName, phase string, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.errors = append(r.errors, resourceError{resourceName: resourceName, phase: phase, err: err})
+}
+
+// failed - check if a resource type failed in the given phase
+func (r *runErrors) failed(resourceName, phase string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, resourceErr := range r.errors {
+		if resourceErr.resourceName == resourceName && resourceErr.phase == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// errorOrNil - the consolidated report if anything failed
+func (r *runErrors) errorOrNil() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.errors) == 0 {
+		return nil
+	}
+	return r
+}
+
+// Error - consolidated report of every failure, sorted by resource type
+func (r *runErrors) Error() string {
+	sorted := append([]resourceError{}, r.errors...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].resourceName < sorted[j].resourceName
+	})
+
+	lines := []string{fmt.Sprintf("[Error] %v error(s) in project %v:", len(sorted), r.project)}
+	for _, resourceErr := range sorted {
+		lines = append(lines, fmt.Sprintf("  %v (%v): %v", resourceErr.resourceName, resourceErr.phase, resourceErr.err))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// projectResult - outcome of one project of a run
+type projectResult struct {
+	project string
+	report  *runReport
+	err     error
+}
+
+// reportProjects - writes the JSON report of every project and logs a summary per project. The error of a single
+// project is returned as is, errors of several projects are combined.
+func reportProjects(results []projectResult) error {
+	var writeErr error
+	if len(results) > 0 && results[0].report.format == config.OutputJSON {
+		items := []reportItem{}
+		for _, result := range results {
+			items = append(items, result.report.items...)
+		}
+		sortReportItems(items)
+		encoder := json.NewEncoder(reportWriter)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(items); err != nil {
+			writeErr = fmt.Errorf("[Error] Unable to write report: %v", err)
+		}
+	}
+
+	failed := []string{}
+	log.Printf("-- Summary of %v project(s) --", len(results))
+	for _, result := range results {
+		counts := result.report.counts()
+		status := "Done"
+		if result.err != nil {
+			status = "Failed"
+			failed = append(failed, result.err.Error())
+		}
+		log.Printf("[%v] %v: %v deleted, %v would be deleted, %v filtered, %v failed", status, result.project, counts[actionDeleted], counts[actionWouldDelete], counts[actionFiltered], counts[actionFailed])
+		for _, lien := range result.report.liens() {
+			log.Printf("  Lien %v (%v) created by %v: %v", lien.Name, lien.Action, lien.Origin, lien.Reason)
+		}
+	}
+
+	switch {
+	case writeErr != nil:
+		return writeErr
+	case len(results) == 1:
+		return results[0].err
+	case len(failed) > 0:
+		return fmt.Errorf("[Error] %v of %v projects failed:\n%v", len(failed), len(results), strings.Join(failed, "\n"))
+	}
+	return nil
+}
@@ -7,8 +7,6 @@ import (
 	"golang.org/x/sync/syncmap"
 	"google.golang.org/api/secretmanager/v1"
 	"log"
-	"strings"
-	"sync"
 )
 
 // SecretManagerSecrets -
@@ -19,14 +17,7 @@ type SecretManagerSecrets struct {
 }
 
 func init() {
-	secretmanagerService, err := secretmanager.NewService(Ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	secretmanagerResource := SecretManagerSecrets{
-		serviceClient: secretmanagerService,
-	}
-	register(&secretmanagerResource)
+	register(func() Resource { return &SecretManagerSecrets{} })
 }
 
 // Name - Name of the resourceLister for SecretManagerSecrets
@@ -40,40 +31,63 @@ func (c *SecretManagerSecrets) ToSlice() (slice []string) {
 
 }
 
-// Setup - populates the struct
-func (c *SecretManagerSecrets) Setup(config config.Config) {
+// Filtered - Items of SecretManagerSecrets which were kept by a filter during the last listing
+func (c *SecretManagerSecrets) Filtered() map[string]string {
+	return c.base.filteredItems()
+}
+
+// Properties - Properties of the items of SecretManagerSecrets seen during the last listing, including filtered ones
+func (c *SecretManagerSecrets) Properties() map[string]DefaultResourceProperties {
+	return c.base.itemProperties()
+}
+
+// Setup - populates the struct and creates the API client
+func (c *SecretManagerSecrets) Setup(config config.Config) error {
 	c.base.config = config
+
+	secretmanagerService, err := secretmanager.NewService(config.Context, clientOptions(config, "secretmanager")...)
+	if err != nil {
+		return err
+	}
+	c.serviceClient = secretmanagerService
+	return nil
 }
 
 // List - Returns a list of all SecretManagerSecrets
-func (c *SecretManagerSecrets) List(refreshCache bool) []string {
+func (c *SecretManagerSecrets) List(refreshCache bool) ([]string, error) {
 	if !refreshCache {
-		return c.ToSlice()
+		return c.ToSlice(), nil
 	}
 	// Refresh resource map
-	c.resourceMap = sync.Map{}
+	helpers.ClearSyncMap(&c.resourceMap)
+	c.base.resetFiltered()
 
 	// List all buckets in a project
-	secretsListCall := c.serviceClient.Projects.Secrets.List("projects/" + c.base.config.Project)
-	secretsList, err := secretsListCall.Do()
+	err := c.serviceClient.Projects.Secrets.List("projects/"+c.base.config.Project).Pages(c.base.config.Context, func(secretsList *secretmanager.ListSecretsResponse) error {
+		for _, secret := range secretsList.Secrets {
+			instanceResource := DefaultResourceProperties{
+				labels:  secret.Labels,
+				created: parseCreationTime(secret.CreateTime),
+			}
+			if c.base.filtered(c.Name(), secret.Name, instanceResource) {
+				continue
+			}
+			c.resourceMap.Store(secret.Name, instanceResource)
+		}
+		return nil
+	})
 	if err != nil {
 		// check if the API is enabled/
-		if !strings.Contains(err.Error(), "API has not been used in project") ||
-			!strings.Contains(err.Error(), "got HTTP response code 404") {
-			// Otherwise, throw an error.
-			log.Fatal(err)
+		if errorClass := classifyAPIError(err); errorClass != apiErrorDisabled && errorClass != apiErrorNotFound {
+			// Otherwise, return the error.
+			return nil, err
 		} else {
 			log.Println("SecretManager API not enabled. Skipping.")
-			return c.ToSlice()
+			return c.ToSlice(), nil
 		}
 	}
 
-	for _, secret := range secretsList.Secrets {
-		instanceResource := DefaultResourceProperties{}
-		c.resourceMap.Store(secret.Name, instanceResource)
-	}
-
-	return c.ToSlice()
+	return c.ToSlice(), nil
 }
 
 // Dependencies - Returns a List of resource names to check for
@@ -81,6 +95,11 @@ func (c *SecretManagerSecrets) Dependencies() []string {
 	return []string{}
 }
 
+// Service - API service of the items of SecretManagerSecrets
+func (c *SecretManagerSecrets) Service() string {
+	return "secretmanager.googleapis.com"
+}
+
 // Remove -
 func (c *SecretManagerSecrets) Remove() error {
 
@@ -95,7 +114,7 @@ func (c *SecretManagerSecrets) Remove() error {
 
 			// Delete the dataset
 			secretDeleteCall := c.serviceClient.Projects.Secrets.Delete(secretID)
-			_, err := secretDeleteCall.Do()
+			_, err := secretDeleteCall.Context(c.base.config.Context).Do()
 			if err != nil {
 				return err
 			}
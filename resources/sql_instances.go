@@ -3,9 +3,6 @@ package resources
 import (
 	"fmt"
 	"log"
-	"strings"
-	"sync"
-	"time"
 
 	"github.com/ianbrown78/gcp-nuke/config"
 	"github.com/ianbrown78/gcp-nuke/helpers"
@@ -22,14 +19,7 @@ type SQLInstances struct {
 }
 
 func init() {
-	sqlService, err := sqladmin.NewService(Ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	sqlResource := SQLInstances{
-		serviceClient: sqlService,
-	}
-	register(&sqlResource)
+	register(func() Resource { return &SQLInstances{} })
 }
 
 // Name - Name of the resourceLister for SqlInstances
@@ -43,40 +33,67 @@ func (c *SQLInstances) ToSlice() (slice []string) {
 
 }
 
-// Setup - populates the struct
-func (c *SQLInstances) Setup(config config.Config) {
+// Filtered - Items of SqlInstances which were kept by a filter during the last listing
+func (c *SQLInstances) Filtered() map[string]string {
+	return c.base.filteredItems()
+}
+
+// Properties - Properties of the items of SqlInstances seen during the last listing, including filtered ones
+func (c *SQLInstances) Properties() map[string]DefaultResourceProperties {
+	return c.base.itemProperties()
+}
+
+// Setup - populates the struct and creates the API client
+func (c *SQLInstances) Setup(config config.Config) error {
 	c.base.config = config
+
+	sqlService, err := sqladmin.NewService(config.Context, clientOptions(config, "sqladmin")...)
+	if err != nil {
+		return err
+	}
+	c.serviceClient = sqlService
+	return nil
 }
 
 // List - Returns a list of all SqlInstances
-func (c *SQLInstances) List(refreshCache bool) []string {
+func (c *SQLInstances) List(refreshCache bool) ([]string, error) {
 	if !refreshCache {
-		return c.ToSlice()
+		return c.ToSlice(), nil
 	}
 	// Refresh resource map
-	c.resourceMap = sync.Map{}
+	helpers.ClearSyncMap(&c.resourceMap)
+	c.base.resetFiltered()
 
-	instanceListCall := c.serviceClient.Instances.List(c.base.config.Project)
-	instanceList, err := instanceListCall.Do()
+	err := c.serviceClient.Instances.List(c.base.config.Project).Pages(c.base.config.Context, func(instanceList *sqladmin.InstancesListResponse) error {
+		for _, instance := range instanceList.Items {
+			if !itemLocationSelected(c.base.config, instance.Region) {
+				continue
+			}
+			instanceResource := DefaultResourceProperties{
+				region:    instance.Region,
+				protected: instance.Settings.DeletionProtectionEnabled,
+				labels:    instance.Settings.UserLabels,
+				created:   parseCreationTime(instance.CreateTime),
+				sizeBytes: instance.Settings.DataDiskSizeGb * gibibyte,
+			}
+			if c.base.filtered(c.Name(), instance.Name, instanceResource) {
+				continue
+			}
+			c.resourceMap.Store(instance.Name, instanceResource)
+		}
+		return nil
+	})
 	if err != nil {
 		// check if the API is enabled/
-		if !strings.Contains(err.Error(), "API has not been used in project") {
-			// Otherwise, throw an error.
-			log.Fatal(err)
+		if classifyAPIError(err) != apiErrorDisabled {
+			// Otherwise, return the error.
+			return nil, err
 		} else {
 			log.Printf("SQLAdmin API not enabled in project %v. Skipping.", c.base.config.Project)
-			return c.ToSlice()
+			return c.ToSlice(), nil
 		}
 	}
-
-	for _, instance := range instanceList.Items {
-
-		instanceResource := DefaultResourceProperties{
-			protected: instance.Settings.DeletionProtectionEnabled,
-		}
-		c.resourceMap.Store(instance.Name, instanceResource)
-	}
-	return c.ToSlice()
+	return c.ToSlice(), nil
 }
 
 // Dependencies - Returns a List of resource names to check for
@@ -84,6 +101,11 @@ func (c *SQLInstances) Dependencies() []string {
 	return []string{}
 }
 
+// Service - API service of the items of SQLInstances
+func (c *SQLInstances) Service() string {
+	return "sqladmin.googleapis.com"
+}
+
 // Remove -
 func (c *SQLInstances) Remove() error {
 
@@ -101,64 +123,36 @@ func (c *SQLInstances) Remove() error {
 			if protected == true {
 				log.Printf("SQL instance %v has deletion protection enabled. Disabling", instanceID)
 				instanceCall := c.serviceClient.Instances.Get(c.base.config.Project, instanceID)
-				instance, err := instanceCall.Do()
+				instance, err := instanceCall.Context(c.base.config.Context).Do()
 				if err != nil {
-					log.Fatalf("Could not get CloudSQL instance %v", instanceID)
+					return fmt.Errorf("could not get CloudSQL instance %v: %v", instanceID, err)
 				}
 
 				instance.Settings.DeletionProtectionEnabled = false
 				instanceUpdateCall := c.serviceClient.Instances.Update(c.base.config.Project, instance.Name, instance)
-				updateOp, err := instanceUpdateCall.Do()
+				updateOp, err := instanceUpdateCall.Context(c.base.config.Context).Do()
 				if err != nil {
-					log.Fatal(err)
+					return fmt.Errorf("could not disable deletion protection of CloudSQL instance %v: %v", instanceID, err)
 				}
-				var updateOpStatus string
-				seconds := 0
-				for updateOpStatus != "DONE" {
-					log.Printf("[Info] Removing deletion protection for %v (%v seconds)", instanceID, seconds)
-
-					operationCall := c.serviceClient.Operations.Get(c.base.config.Project, updateOp.Name)
-					checkOpp, err := operationCall.Do()
-					if err != nil {
-						return err
-					}
-					updateOpStatus = checkOpp.Status
-
-					time.Sleep(time.Duration(c.base.config.PollTime) * time.Second)
-					seconds += c.base.config.PollTime
-					if seconds > c.base.config.Timeout {
-						return fmt.Errorf("[Error] Resource deletionprotection removal timed out for %v (%v seconds)", instanceID, c.base.config.Timeout)
-					}
+				err = waitForOperation(c.base.config, fmt.Sprintf("deletion protection removal of %v [type: %v project: %v]", instanceID, c.Name(), c.base.config.Project), sqlOperation(c.serviceClient, c.base.config.Project, updateOp))
+				if err != nil {
+					return err
 				}
-				log.Printf("[Info] Deletion protection removal completed for %v (%v seconds)", instanceID, seconds)
+				log.Printf("[Info] Deletion protection removal completed for %v", instanceID)
 			}
 
 			deleteCall := c.serviceClient.Instances.Delete(c.base.config.Project, instanceID)
-			operation, err := deleteCall.Do()
+			operation, err := deleteCall.Context(c.base.config.Context).Do()
 			if err != nil {
 				return err
 			}
-			var opStatus string
-			seconds := 0
-			for opStatus != "DONE" {
-				log.Printf("[Info] Resource currently being deleted %v [type: %v project: %v zone: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, zone, seconds)
-
-				operationCall := c.serviceClient.Operations.Get(c.base.config.Project, operation.Name)
-				checkOpp, err := operationCall.Do()
-				if err != nil {
-					return err
-				}
-				opStatus = checkOpp.Status
-
-				time.Sleep(time.Duration(c.base.config.PollTime) * time.Second)
-				seconds += c.base.config.PollTime
-				if seconds > c.base.config.Timeout {
-					return fmt.Errorf("[Error] Resource deletion timed out for %v [type: %v project: %v zone: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, zone, c.base.config.Timeout)
-				}
+			err = waitForOperation(c.base.config, fmt.Sprintf("deletion of %v [type: %v project: %v zone: %v]", instanceID, c.Name(), c.base.config.Project, zone), sqlOperation(c.serviceClient, c.base.config.Project, operation))
+			if err != nil {
+				return err
 			}
 			c.resourceMap.Delete(instanceID)
 
-			log.Printf("[Info] Resource deleted %v [type: %v project: %v zone: %v] (%v seconds)", instanceID, c.Name(), c.base.config.Project, zone, seconds)
+			log.Printf("[Info] Resource deleted %v [type: %v project: %v zone: %v]", instanceID, c.Name(), c.base.config.Project, zone)
 			return nil
 		})
 
@@ -1,6 +1,7 @@
 package resources
 
 import (
+	"fmt"
 	"github.com/ianbrown78/gcp-nuke/config"
 	"github.com/ianbrown78/gcp-nuke/helpers"
 	"golang.org/x/sync/errgroup"
@@ -8,7 +9,6 @@ import (
 	"google.golang.org/api/storage/v1"
 	"log"
 	"strings"
-	"sync"
 )
 
 // StorageBuckets -
@@ -19,14 +19,7 @@ type StorageBuckets struct {
 }
 
 func init() {
-	storageService, err := storage.NewService(Ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	storageResource := StorageBuckets{
-		serviceClient: storageService,
-	}
-	register(&storageResource)
+	register(func() Resource { return &StorageBuckets{} })
 }
 
 // Name - Name of the resourceLister for StorageBuckets
@@ -40,39 +33,67 @@ func (c *StorageBuckets) ToSlice() (slice []string) {
 
 }
 
-// Setup - populates the struct
-func (c *StorageBuckets) Setup(config config.Config) {
+// Filtered - Items of StorageBuckets which were kept by a filter during the last listing
+func (c *StorageBuckets) Filtered() map[string]string {
+	return c.base.filteredItems()
+}
+
+// Properties - Properties of the items of StorageBuckets seen during the last listing, including filtered ones
+func (c *StorageBuckets) Properties() map[string]DefaultResourceProperties {
+	return c.base.itemProperties()
+}
+
+// Setup - populates the struct and creates the API client
+func (c *StorageBuckets) Setup(config config.Config) error {
 	c.base.config = config
+
+	storageService, err := storage.NewService(config.Context, clientOptions(config, "storage")...)
+	if err != nil {
+		return err
+	}
+	c.serviceClient = storageService
+	return nil
 }
 
 // List - Returns a list of all StorageBuckets
-func (c *StorageBuckets) List(refreshCache bool) []string {
+func (c *StorageBuckets) List(refreshCache bool) ([]string, error) {
 	if !refreshCache {
-		return c.ToSlice()
+		return c.ToSlice(), nil
 	}
 	// Refresh resource map
-	c.resourceMap = sync.Map{}
+	helpers.ClearSyncMap(&c.resourceMap)
+	c.base.resetFiltered()
 
 	// List all buckets in a project
-	bucketsListCall := c.serviceClient.Buckets.List(c.base.config.Project)
-	bucketsList, err := bucketsListCall.Do()
+	err := c.serviceClient.Buckets.List(c.base.config.Project).Pages(c.base.config.Context, func(bucketsList *storage.Buckets) error {
+		for _, instance := range bucketsList.Items {
+			if !itemLocationSelected(c.base.config, instance.Location) {
+				continue
+			}
+			instanceResource := DefaultResourceProperties{
+				region:  strings.ToLower(instance.Location),
+				labels:  instance.Labels,
+				created: parseCreationTime(instance.TimeCreated),
+			}
+			if c.base.filtered(c.Name(), instance.Name, instanceResource) {
+				continue
+			}
+			c.resourceMap.Store(instance.Name, instanceResource)
+		}
+		return nil
+	})
 	if err != nil {
 		// check if the API is enabled/
-		if !strings.Contains(err.Error(), "API has not been used in project") {
-			// Otherwise, throw an error.
-			log.Fatal(err)
+		if classifyAPIError(err) != apiErrorDisabled {
+			// Otherwise, return the error.
+			return nil, err
 		} else {
 			log.Println("Storage API not enabled. Skipping.")
-			return c.ToSlice()
+			return c.ToSlice(), nil
 		}
 	}
 
-	for _, instance := range bucketsList.Items {
-		instanceResource := DefaultResourceProperties{}
-		c.resourceMap.Store(instance.Name, instanceResource)
-	}
-
-	return c.ToSlice()
+	return c.ToSlice(), nil
 }
 
 // Dependencies - Returns a List of resource names to check for
@@ -80,6 +101,11 @@ func (c *StorageBuckets) Dependencies() []string {
 	return []string{}
 }
 
+// Service - API service of the items of StorageBuckets
+func (c *StorageBuckets) Service() string {
+	return "storage.googleapis.com"
+}
+
 // Remove -
 func (c *StorageBuckets) Remove() error {
 
@@ -90,42 +116,49 @@ func (c *StorageBuckets) Remove() error {
 		bucketID := key.(string)
 		zone := value.(DefaultResourceProperties).zone
 
-		// Check if there is a retention period or lock on the bucket
-		bucketCall := c.serviceClient.Buckets.Get(bucketID)
-		bucket, _ := bucketCall.Do()
-		policy := bucket.RetentionPolicy
-
-		log.Printf("Removing bucket %v", bucketID)
-		if policy != nil && policy.IsLocked == true {
-			// throw an error about the bucket being locked.
-			log.Printf("Bucket %v has a bucket policy that is currently locked.", bucketID)
-			return true
-		}
-		if policy != nil && policy.RetentionPeriod > 0 {
-			// throw an error about the retention policy being not zero.
-			log.Printf("Bucket %v has a bucket policy retention period of %v seconds.", bucketID, policy.RetentionPeriod)
-			log.Printf("Bucket %v retention policy will be updated to 0 seconds.", bucketID)
-
-			bucket, _ := c.serviceClient.Buckets.Get(bucketID).Do()
-			bucket.RetentionPolicy.RetentionPeriod = 0
-			bucketUpdateCall := c.serviceClient.Buckets.Patch(bucketID, bucket)
-			_, err := bucketUpdateCall.Do()
+		// Parallel instance deletion
+		errs.Go(func() error {
+			// Check if there is a retention period or lock on the bucket
+			bucketCall := c.serviceClient.Buckets.Get(bucketID)
+			bucket, err := bucketCall.Context(c.base.config.Context).Do()
 			if err != nil {
-				return false
+				return err
 			}
-		}
+			policy := bucket.RetentionPolicy
 
-		// Parallel instance deletion
-		errs.Go(func() error {
-			// Get objects
-			objectsListCall := c.serviceClient.Objects.List(bucketID)
-			objectsList, _ := objectsListCall.Do()
+			log.Printf("Removing bucket %v", bucketID)
+			if policy != nil && policy.IsLocked == true {
+				return fmt.Errorf("bucket %v has a bucket policy that is currently locked", bucketID)
+			}
+			if policy != nil && policy.RetentionPeriod > 0 {
+				// throw an error about the retention policy being not zero.
+				log.Printf("Bucket %v has a bucket policy retention period of %v seconds.", bucketID, policy.RetentionPeriod)
+				log.Printf("Bucket %v retention policy will be updated to 0 seconds.", bucketID)
+
+				bucket.RetentionPolicy.RetentionPeriod = 0
+				bucketUpdateCall := c.serviceClient.Buckets.Patch(bucketID, bucket)
+				_, err := bucketUpdateCall.Context(c.base.config.Context).Do()
+				if err != nil {
+					return err
+				}
+			}
+
+			// Get objects, all pages first as deleting while paging would shift the pages
+			objectNames := []string{}
+			err = c.serviceClient.Objects.List(bucketID).Pages(c.base.config.Context, func(objectsList *storage.Objects) error {
+				for _, object := range objectsList.Items {
+					objectNames = append(objectNames, object.Name)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
 
 			// Delete objects
-			for _, object := range objectsList.Items {
-				objectName := object.Name
+			for _, objectName := range objectNames {
 				objectDeleteCall := c.serviceClient.Objects.Delete(bucketID, objectName)
-				err := objectDeleteCall.Do()
+				err := objectDeleteCall.Context(c.base.config.Context).Do()
 				if err != nil {
 					return err
 				}
@@ -133,7 +166,7 @@ func (c *StorageBuckets) Remove() error {
 
 			// Now delete the bucket
 			deleteCall := c.serviceClient.Buckets.Delete(bucketID)
-			err := deleteCall.Do()
+			err = deleteCall.Context(c.base.config.Context).Do()
 			if err != nil {
 				return err
 			}
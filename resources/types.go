@@ -0,0 +1,101 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Formats of the list of resource types
+const (
+	TypesText = "text"
+	TypesJSON = "json"
+	TypesDOT  = "dot"
+)
+
+// ResourceType - a registered resource type and its place in the deletion order
+type ResourceType struct {
+	Name    string `json:"name"`
+	Service string `json:"service"`
+	// Dependencies - types deleted before this one
+	Dependencies []string `json:"dependencies"`
+	// Wave - deletion wave of the type when every type is selected, starting at 1
+	Wave int `json:"wave"`
+}
+
+// ResourceTypes - every registered resource type, sorted by deletion wave and name
+func ResourceTypes() ([]ResourceType, error) {
+	resources := registeredResources()
+	graph, err := newDependencyGraph(resources)
+	if err != nil {
+		return nil, err
+	}
+	types := []ResourceType{}
+	for i, wave := range graph.waves() {
+		for _, name := range wave {
+			dependencies := append([]string{}, resources[name].Dependencies()...)
+			sort.Strings(dependencies)
+			types = append(types, ResourceType{
+				Name:         name,
+				Service:      resources[name].Service(),
+				Dependencies: dependencies,
+				Wave:         i + 1,
+			})
+		}
+	}
+	return types, nil
+}
+
+// WriteResourceTypes - writes every registered resource type as a text table, JSON or a Graphviz DOT graph
+func WriteResourceTypes(w io.Writer, format string) error {
+	types, err := ResourceTypes()
+	if err != nil {
+		return err
+	}
+	switch format {
+	case TypesText:
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "WAVE\tTYPE\tSERVICE\tDEPENDENCIES")
+		for _, resourceType := range types {
+			dependencies := strings.Join(resourceType.Dependencies, ", ")
+			if dependencies == "" {
+				dependencies = "-"
+			}
+			fmt.Fprintf(table, "%v\t%v\t%v\t%v\n", resourceType.Wave, resourceType.Name, resourceType.Service, dependencies)
+		}
+		return table.Flush()
+	case TypesJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(types)
+	case TypesDOT:
+		// Edges point from a type to the types deleted before it, types of a wave share a rank
+		lines := []string{"digraph deletion_order {", "  rankdir=LR;", "  node [shape=box];"}
+		wave := 0
+		for _, resourceType := range types {
+			if resourceType.Wave != wave {
+				if wave > 0 {
+					lines = append(lines, "  }")
+				}
+				wave = resourceType.Wave
+				lines = append(lines, fmt.Sprintf("  subgraph wave_%v {", wave), "    rank=same;")
+			}
+			lines = append(lines, fmt.Sprintf("    %q [label=%q];", resourceType.Name, resourceType.Name+"\n"+resourceType.Service))
+		}
+		if wave > 0 {
+			lines = append(lines, "  }")
+		}
+		for _, resourceType := range types {
+			for _, dependency := range resourceType.Dependencies {
+				lines = append(lines, fmt.Sprintf("  %q -> %q;", resourceType.Name, dependency))
+			}
+		}
+		lines = append(lines, "}")
+		_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+		return err
+	}
+	return fmt.Errorf("unknown format %v, expected %v, %v or %v", format, TypesText, TypesJSON, TypesDOT)
+}